@@ -44,12 +44,20 @@ type AvailabilitiesGetCall struct {
 
 	manufacturer string
 	header       http.Header
+	ctx          context.Context
+}
+
+// Context sets the context used for the request. Cancelling it aborts all
+// attempts of the request.
+func (c *AvailabilitiesGetCall) Context(ctx context.Context) *AvailabilitiesGetCall {
+	c.ctx = ctx
+	return c
 }
 
 // Do executes a get call request
 func (c *AvailabilitiesGetCall) Do() (*Availability, error) {
 	urls := c.s.baseURL + "availability/" + c.manufacturer
-	req, err := http.NewRequest(http.MethodGet, urls, nil)
+	req, err := newRequest(c.ctx, urls)
 	if err != nil {
 		return nil, err
 	}
@@ -84,11 +92,15 @@ func (c *AvailabilitiesGetCall) executeRequest(req *http.Request) (*http.Respons
 		go func(context.Context) {
 			res, err := c.s.Do(req)
 			if err != nil {
-				errCh <- err
+				select {
+				case <-ctx.Done():
+				case errCh <- err:
+				}
 				return
 			}
 			select {
 			case <-ctx.Done():
+				_ = res.Body.Close()
 			case resCh <- res:
 			}
 		}(ctx)
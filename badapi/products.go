@@ -1,6 +1,7 @@
 package badapi
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"strings"
@@ -37,12 +38,20 @@ type ProductsListCall struct {
 
 	ctg    string
 	header http.Header
+	ctx    context.Context
+}
+
+// Context sets the context used for the request. Cancelling it aborts the
+// request.
+func (c *ProductsListCall) Context(ctx context.Context) *ProductsListCall {
+	c.ctx = ctx
+	return c
 }
 
 // Do executes a list call
 func (c *ProductsListCall) Do() (*ProductsListResponse, error) {
 	urls := c.s.baseURL + "products/" + c.ctg
-	req, err := http.NewRequest(http.MethodGet, urls, nil)
+	req, err := newRequest(c.ctx, urls)
 	if err != nil {
 		return nil, err
 	}
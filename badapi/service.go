@@ -1,14 +1,23 @@
 package badapi
 
 import (
+	"context"
 	"net/http"
+	"path"
 	"time"
 )
 
 // Service represents the badapi
 type Service struct {
-	c       *http.Client
-	baseURL string
+	c        *http.Client
+	baseURL  string
+	observer RequestObserver
+}
+
+// RequestObserver is notified of every request executed by a Service. The
+// endpoint is the resource requested, e.g. "products" or "availability".
+type RequestObserver interface {
+	ObserveRequest(endpoint string, duration time.Duration, err error)
 }
 
 // ServerResponse includes response data. Included in all direct responses.
@@ -32,14 +41,38 @@ func (s *Service) URL(urls string) *Service {
 	return s
 }
 
+// newRequest creates a GET request bound to ctx, if set.
+func newRequest(ctx context.Context, urls string) (*http.Request, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return http.NewRequestWithContext(ctx, http.MethodGet, urls, nil)
+}
+
+// Observer sets a RequestObserver for a badapi service
+func (s *Service) Observer(o RequestObserver) *Service {
+	s.observer = o
+	return s
+}
+
 // Do executes a http request and returns the response or an error. Exactly one
 // return value will be non-nil.
 func (s *Service) Do(req *http.Request) (*http.Response, error) {
+	startAt := time.Now()
+	res, err := s.do(req)
+	if s.observer != nil {
+		s.observer.ObserveRequest(path.Base(path.Dir(req.URL.Path)), time.Since(startAt), err)
+	}
+	return res, err
+}
+
+func (s *Service) do(req *http.Request) (*http.Response, error) {
 	res, err := s.c.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	if res.Header.Get("X-Error-Modes-Active") != "" {
+		_ = res.Body.Close()
 		return nil, ErrModeActive
 	}
 	return res, nil
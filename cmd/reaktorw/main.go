@@ -6,11 +6,16 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime/pprof"
 	"syscall"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/juju/clock"
+	"github.com/nikunicke/reaktorw/cmd/reaktorw/metrics"
 	"github.com/nikunicke/reaktorw/cmd/reaktorw/service"
+	"github.com/nikunicke/reaktorw/cmd/reaktorw/service/admin"
 	"github.com/nikunicke/reaktorw/cmd/reaktorw/service/frontend"
 	"github.com/nikunicke/reaktorw/cmd/reaktorw/service/updater"
 	"github.com/nikunicke/reaktorw/warehouse/store/memory"
@@ -72,30 +77,99 @@ func setupServices(logger *logrus.Entry) (service.Group, error) {
 		serviceGroup service.Group
 	)
 
+	// metrics
+	appMetrics := metrics.New()
+
+	// The warehouse stamps quarantined availabilities with the clock the
+	// updater expires them by.
+	clk := clock.WallClock
+
 	// warehouse
 	warehouse := memory.NewInMemoryWarehouse()
+	warehouse.UseClock(clk)
+	warehouse.ObserveLockWait(appMetrics.ObserveLockWait)
+	appMetrics.RegisterWarehouse(warehouse)
 
 	// updater
 	updaterConf.WarehouseAPI = warehouse
-	updaterConf.UpdateInterval = 5 * time.Minute
+	updaterConf.Clock = clk
+	updaterConf.Metrics = appMetrics
+	updaterConf.Products = updater.JobConfig{
+		Scheduler: func() updater.Scheduler {
+			return updater.WithBackoff(
+				updater.WithJitter(updater.Adaptive(2*time.Minute, 10*time.Minute, 2), 15*time.Second),
+				30*time.Second, 5*time.Minute,
+			)
+		},
+		Timeout: time.Minute,
+	}
+	updaterConf.Availabilities = updater.JobConfig{
+		Scheduler: func() updater.Scheduler {
+			return updater.WithBackoff(
+				updater.WithJitter(updater.Every(5*time.Minute), 30*time.Second),
+				30*time.Second, 5*time.Minute,
+			)
+		},
+		Timeout: 2 * time.Minute,
+	}
+	if expr := os.Getenv("UPDATE_CRON"); expr != "" {
+		cronScheduler, err := updater.Cron(expr)
+		if err != nil {
+			return nil, err
+		}
+		cronJob := func() updater.Scheduler {
+			return updater.WithBackoff(cronScheduler, 30*time.Second, 5*time.Minute)
+		}
+		updaterConf.Products.Scheduler = cronJob
+		updaterConf.Availabilities.Scheduler = cronJob
+	}
+	if dir := os.Getenv("REPLICA_DIR"); dir != "" {
+		// Replicas sharing dir elect a leader to load data from badapi.
+		updaterConf.Lock = updater.NewFileLock(filepath.Join(dir, "leader.lock"), uuid.New().String(), 30*time.Second)
+		updaterConf.Snapshots = updater.NewFileSnapshotStore(filepath.Join(dir, "snapshot.json.gz"))
+	}
 	updaterConf.Logger = logger.WithField("service", "warehouse-updater")
-	if service, err := updater.NewService(updaterConf); err == nil {
-		serviceGroup = append(serviceGroup, service)
-	} else {
+	updaterService, err := updater.NewService(updaterConf)
+	if err != nil {
 		return nil, err
 	}
+	serviceGroup = append(serviceGroup, updaterService)
 	// frontend
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "5000"
 	}
 	frontendConf.WarehouseAPI = warehouse
+	frontendConf.StatusAPI = updaterService
+	frontendConf.Metrics = appMetrics
 	frontendConf.ListenAddr = ":" + port
 	frontendConf.Logger = logger.WithField("service", "frontend")
-	if service, err := frontend.NewService(frontendConf); err == nil {
-		serviceGroup = append(serviceGroup, service)
-	} else {
+	frontendService, err := frontend.NewService(frontendConf)
+	if err != nil {
 		return nil, err
 	}
+	serviceGroup = append(serviceGroup, frontendService)
+	updaterService.Subscribe(func(updater.Report) {
+		if err := frontendService.Rebuild(); err != nil {
+			frontendConf.Logger.WithField("error", err).Error("failed to rebuild category cache")
+		}
+	})
+	// admin
+	if token := os.Getenv("ADMIN_TOKEN"); token != "" {
+		adminAddr := os.Getenv("ADMIN_ADDR")
+		if adminAddr == "" {
+			adminAddr = "localhost:5001"
+		}
+		adminService, err := admin.NewService(admin.Config{
+			UpdaterAPI: updaterService,
+			ListenAddr: adminAddr,
+			Token:      token,
+			Logger:     logger.WithField("service", "admin"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		serviceGroup = append(serviceGroup, adminService)
+	}
 	return serviceGroup, nil
 }
@@ -0,0 +1,245 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nikunicke/reaktorw/badapi"
+	"github.com/nikunicke/reaktorw/pipeline"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/xerrors"
+)
+
+const namespace = "reaktorw"
+
+// Warehouse is the part of the warehouse the metrics are collected from.
+type Warehouse interface {
+	CategorySizes() map[string]int
+}
+
+// Metrics holds the prometheus collectors of the application.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	badapiRequestDuration *prometheus.HistogramVec
+	badapiRequests        *prometheus.CounterVec
+	badapiErrorModeActive *prometheus.CounterVec
+	stagePayloads         *prometheus.CounterVec
+	stageDuration         *prometheus.HistogramVec
+	stageQueueDepth       *prometheus.GaugeVec
+	stageRunDuration      *prometheus.HistogramVec
+	lockWait              *prometheus.HistogramVec
+	httpRequestDuration   *prometheus.HistogramVec
+}
+
+// New initiates the application metrics on a dedicated registry.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		badapiRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "badapi",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of badapi requests per endpoint.",
+			Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 15, 20, 30},
+		}, []string{"endpoint"}),
+		badapiRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "badapi",
+			Name:      "requests_total",
+			Help:      "Request attempts to badapi per endpoint and result.",
+		}, []string{"endpoint", "result"}),
+		badapiErrorModeActive: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "badapi",
+			Name:      "error_mode_active_total",
+			Help:      "Responses from badapi with error modes active per endpoint.",
+		}, []string{"endpoint"}),
+		stagePayloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "pipeline",
+			Name:      "payloads_total",
+			Help:      "Payloads processed per pipeline stage and result.",
+		}, []string{"pipeline", "stage", "result"}),
+		stageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "pipeline",
+			Name:      "process_duration_seconds",
+			Help:      "Time spent processing a payload per pipeline stage.",
+			Buckets:   prometheus.ExponentialBuckets(.00001, 4, 10),
+		}, []string{"pipeline", "stage"}),
+		stageQueueDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "pipeline",
+			Name:      "queue_depth",
+			Help:      "Payloads waiting in front of each pipeline stage, sampled when a payload is queued and reset when the run ends.",
+		}, []string{"pipeline", "stage"}),
+		stageRunDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "pipeline",
+			Name:      "stage_duration_seconds",
+			Help:      "Time each pipeline stage ran for per pipeline run.",
+			Buckets:   prometheus.ExponentialBuckets(.01, 4, 8),
+		}, []string{"pipeline", "stage"}),
+		lockWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "warehouse",
+			Name:      "lock_wait_seconds",
+			Help:      "Time spent waiting for the warehouse lock per lock mode.",
+			Buckets:   prometheus.ExponentialBuckets(.000001, 4, 12),
+		}, []string{"mode"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of HTTP requests per route, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "code"}),
+	}
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.badapiRequestDuration,
+		m.badapiRequests,
+		m.badapiErrorModeActive,
+		m.stagePayloads,
+		m.stageDuration,
+		m.stageQueueDepth,
+		m.stageRunDuration,
+		m.lockWait,
+		m.httpRequestDuration,
+	)
+	return m
+}
+
+// Handler returns the HTTP handler exposing the metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RegisterWarehouse exposes the number of products per category of w.
+func (m *Metrics) RegisterWarehouse(w Warehouse) {
+	m.registry.MustRegister(&warehouseCollector{
+		warehouse: w,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "warehouse", "products"),
+			"Number of products stored per category.",
+			[]string{"category"}, nil,
+		),
+	})
+}
+
+// ObserveRequest implements badapi.RequestObserver.
+func (m *Metrics) ObserveRequest(endpoint string, duration time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.badapiRequests.WithLabelValues(endpoint, result).Inc()
+	m.badapiRequestDuration.WithLabelValues(endpoint).Observe(duration.Seconds())
+	if xerrors.Is(err, badapi.ErrModeActive) {
+		m.badapiErrorModeActive.WithLabelValues(endpoint).Inc()
+	}
+}
+
+// ObserveQueue records the depth of the queue in front of a pipeline stage.
+func (m *Metrics) ObserveQueue(pipelineName string, stageIndex, depth int) {
+	m.stageQueueDepth.WithLabelValues(pipelineName, stageLabel(stageIndex)).Set(float64(depth))
+}
+
+// ObserveLockWait records the time spent waiting for the warehouse lock.
+func (m *Metrics) ObserveLockWait(write bool, wait time.Duration) {
+	mode := "read"
+	if write {
+		mode = "write"
+	}
+	m.lockWait.WithLabelValues(mode).Observe(wait.Seconds())
+}
+
+// PipelineObserver returns an observer counting the payloads processed by
+// each stage of the named pipeline and their processing time.
+func (m *Metrics) PipelineObserver(pipelineName string) pipeline.Observer {
+	return &pipelineObserver{m: m, pipelineName: pipelineName}
+}
+
+type pipelineObserver struct {
+	m            *Metrics
+	pipelineName string
+}
+
+func (o *pipelineObserver) OnPayloadIn(int, pipeline.Payload) {}
+
+func (o *pipelineObserver) OnPayloadOut(stageIndex int, payload pipeline.Payload, duration time.Duration) {
+	result := "ok"
+	if payload == nil {
+		result = "dropped"
+	}
+	o.observe(stageIndex, result, duration)
+}
+
+func (o *pipelineObserver) OnError(stageIndex int, _ pipeline.Payload, _ error, duration time.Duration) {
+	o.observe(stageIndex, "error", duration)
+}
+
+func (o *pipelineObserver) OnStageDone(stageIndex int, duration time.Duration) {
+	o.m.stageRunDuration.WithLabelValues(o.pipelineName, stageLabel(stageIndex)).Observe(duration.Seconds())
+}
+
+func (o *pipelineObserver) observe(stageIndex int, result string, duration time.Duration) {
+	stage := stageLabel(stageIndex)
+	o.m.stagePayloads.WithLabelValues(o.pipelineName, stage, result).Inc()
+	o.m.stageDuration.WithLabelValues(o.pipelineName, stage).Observe(duration.Seconds())
+}
+
+func stageLabel(stageIndex int) string {
+	switch stageIndex {
+	case pipeline.SourceStage:
+		return "source"
+	case pipeline.SinkStage:
+		return "sink"
+	}
+	return strconv.Itoa(stageIndex)
+}
+
+// Middleware records the latency of HTTP requests per route template.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		startAt := time.Now()
+		next.ServeHTTP(sw, r)
+		m.httpRequestDuration.WithLabelValues(route, r.Method, strconv.Itoa(sw.status)).
+			Observe(time.Since(startAt).Seconds())
+	})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+type warehouseCollector struct {
+	warehouse Warehouse
+	desc      *prometheus.Desc
+}
+
+func (c *warehouseCollector) Describe(ch chan<- *prometheus.Desc) { ch <- c.desc }
+
+func (c *warehouseCollector) Collect(ch chan<- prometheus.Metric) {
+	for ctg, size := range c.warehouse.CategorySizes() {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(size), ctg)
+	}
+}
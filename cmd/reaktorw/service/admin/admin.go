@@ -0,0 +1,159 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/nikunicke/reaktorw/cmd/reaktorw/service/httpapi"
+	"github.com/nikunicke/reaktorw/cmd/reaktorw/service/updater"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// maxBodySize bounds the size of admin request bodies.
+	maxBodySize = 1 << 16
+	// bearerPrefix precedes the token in the Authorization header.
+	bearerPrefix = "Bearer "
+)
+
+type UpdaterAPI interface {
+	Trigger(req updater.UpdateRequest) (updater.Run, error)
+	Runs() []updater.Run
+	Pause()
+	Resume()
+	Paused() bool
+	DeadLetters() []updater.DeadLetter
+}
+
+type Config struct {
+	UpdaterAPI UpdaterAPI
+	ListenAddr string
+	// Token authenticates admin requests, which must carry it as a bearer
+	// token in the Authorization header.
+	Token string
+
+	Logger *logrus.Entry
+}
+
+type Service struct {
+	conf   Config
+	router *mux.Router
+}
+
+func (c *Config) validate() error {
+	if c.UpdaterAPI == nil {
+		return xerrors.New("Updater API not provided")
+	}
+	if c.ListenAddr == "" {
+		return xerrors.New("ListenAddr not provided")
+	}
+	if c.Token == "" {
+		return xerrors.New("Token not provided")
+	}
+	if c.Logger == nil {
+		c.Logger = logrus.NewEntry(&logrus.Logger{Out: ioutil.Discard})
+	}
+	return nil
+}
+
+func NewService(conf Config) (*Service, error) {
+	if err := conf.validate(); err != nil {
+		return nil, xerrors.Errorf("admin service: config validation failed: %w", err)
+	}
+	service := &Service{
+		conf:   conf,
+		router: mux.NewRouter(),
+	}
+	service.router.Use(httpapi.WithRequestID(conf.Logger), service.authenticate)
+	service.router.HandleFunc("/admin/updates", service.postUpdate).Methods(http.MethodPost)
+	service.router.HandleFunc("/admin/updates", service.getUpdates).Methods(http.MethodGet)
+	service.router.HandleFunc("/admin/dead-letters", service.getDeadLetters).Methods(http.MethodGet)
+	service.router.HandleFunc("/admin/schedule", service.getSchedule).Methods(http.MethodGet)
+	service.router.HandleFunc("/admin/schedule/pause", service.pauseSchedule).Methods(http.MethodPost)
+	service.router.HandleFunc("/admin/schedule/resume", service.resumeSchedule).Methods(http.MethodPost)
+	return service, nil
+}
+
+func (s *Service) Name() string { return "admin" }
+
+func (s *Service) Run(ctx context.Context) error {
+	s.conf.Logger.WithField("listening on", s.conf.ListenAddr).Info("starting service")
+	defer s.conf.Logger.Info("stopped service")
+	return httpapi.Serve(ctx, s.conf.ListenAddr, s.router)
+}
+
+func (s *Service) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(auth, bearerPrefix)
+		if token == auth || subtle.ConstantTimeCompare([]byte(token), []byte(s.conf.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			httpapi.WriteError(w, r, http.StatusUnauthorized, "unauthorized", "missing or invalid token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Service) postUpdate(w http.ResponseWriter, r *http.Request) {
+	var req updater.UpdateRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&req); err != nil {
+			httpapi.WriteError(w, r, http.StatusBadRequest, "invalid_body", "request body is not a valid update request")
+			return
+		}
+	}
+	run, err := s.conf.UpdaterAPI.Trigger(req)
+	switch {
+	case xerrors.Is(err, updater.ErrUnknownCategory), xerrors.Is(err, updater.ErrUnknownManufacturer):
+		httpapi.WriteError(w, r, http.StatusBadRequest, "unknown_source", err.Error())
+		return
+	case xerrors.Is(err, updater.ErrTriggerQueueFull):
+		httpapi.WriteError(w, r, http.StatusTooManyRequests, "too_many_updates", err.Error())
+		return
+	case err != nil:
+		httpapi.RequestLogger(r).WithField("error", err).Error("failed to trigger update")
+		httpapi.WriteError(w, r, http.StatusInternalServerError, "internal_error", "internal server error")
+		return
+	}
+	httpapi.RequestLogger(r).WithFields(logrus.Fields{
+		"run_id":        run.ID,
+		"categories":    run.Request.Categories,
+		"manufacturers": run.Request.Manufacturers,
+	}).Info("triggered warehouse update")
+	httpapi.WriteJSON(w, http.StatusAccepted, run)
+}
+
+func (s *Service) getUpdates(w http.ResponseWriter, r *http.Request) {
+	httpapi.WriteJSON(w, http.StatusOK, s.conf.UpdaterAPI.Runs())
+}
+
+func (s *Service) getDeadLetters(w http.ResponseWriter, r *http.Request) {
+	httpapi.WriteJSON(w, http.StatusOK, s.conf.UpdaterAPI.DeadLetters())
+}
+
+type scheduleResponse struct {
+	Paused bool `json:"paused"`
+}
+
+func (s *Service) getSchedule(w http.ResponseWriter, r *http.Request) {
+	httpapi.WriteJSON(w, http.StatusOK, scheduleResponse{Paused: s.conf.UpdaterAPI.Paused()})
+}
+
+func (s *Service) pauseSchedule(w http.ResponseWriter, r *http.Request) {
+	s.conf.UpdaterAPI.Pause()
+	httpapi.RequestLogger(r).Info("paused update schedule")
+	httpapi.WriteJSON(w, http.StatusOK, scheduleResponse{Paused: s.conf.UpdaterAPI.Paused()})
+}
+
+func (s *Service) resumeSchedule(w http.ResponseWriter, r *http.Request) {
+	s.conf.UpdaterAPI.Resume()
+	httpapi.RequestLogger(r).Info("resumed update schedule")
+	httpapi.WriteJSON(w, http.StatusOK, scheduleResponse{Paused: s.conf.UpdaterAPI.Paused()})
+}
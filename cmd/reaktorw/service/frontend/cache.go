@@ -0,0 +1,178 @@
+package frontend
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nikunicke/reaktorw/warehouse/inventory"
+)
+
+// categoryCache holds the product listings of each category, serialized in
+// every supported format and pre-compressed with every supported content
+// coding. Serving a listing is a lookup in the current snapshot, which is
+// replaced atomically as a whole by rebuild.
+type categoryCache struct {
+	mu       sync.Mutex // serializes rebuilds
+	snapshot atomic.Value
+}
+
+type cacheSnapshot map[string]*cachedCategory
+
+type cachedCategory struct {
+	version      uint64
+	lastModified time.Time
+	// err is set if the category could not be served, e.g. because the
+	// warehouse does not hold any data for it.
+	err error
+
+	representations map[string]*representation
+}
+
+// representation is a category listing serialized in one format and encoded
+// with each supported content coding.
+type representation struct {
+	etag    string
+	encoded map[string][]byte
+}
+
+func newCategoryCache() *categoryCache {
+	c := new(categoryCache)
+	c.snapshot.Store(cacheSnapshot{})
+	return c
+}
+
+// lookup returns the cached category or nil if it has not been built.
+func (c *categoryCache) lookup(ctg string) *cachedCategory {
+	return c.snapshot.Load().(cacheSnapshot)[ctg]
+}
+
+// rebuild serializes the given categories from the warehouse and swaps in the
+// new snapshot. Categories whose warehouse version did not change since the
+// previous snapshot are carried over as is. If a category fails to build, the
+// previous entry is kept and the error is returned once all categories have
+// been processed.
+func (c *categoryCache) rebuild(api WarehouseAPI, ctgs []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prev := c.snapshot.Load().(cacheSnapshot)
+	next := make(cacheSnapshot, len(ctgs))
+	var errAll error
+	for _, ctg := range ctgs {
+		version := api.CategoryVersion(ctg)
+		if entry := prev[ctg]; entry != nil && entry.version == version {
+			next[ctg] = entry
+			continue
+		}
+		entry, err := buildCategory(api, ctg, version)
+		if err != nil {
+			errAll = err
+			if prev[ctg] != nil {
+				next[ctg] = prev[ctg]
+			}
+			continue
+		}
+		next[ctg] = entry
+	}
+	c.snapshot.Store(next)
+	return errAll
+}
+
+func buildCategory(api WarehouseAPI, ctg string, version uint64) (*cachedCategory, error) {
+	products, err := categoryProducts(api, ctg)
+	if err == inventory.ErrNoDataForCategory {
+		return &cachedCategory{version: version, err: err}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry := &cachedCategory{
+		version:         version,
+		lastModified:    latestRetrievedAt(products),
+		representations: make(map[string]*representation, len(formats)),
+	}
+	for name, f := range formats {
+		rep, err := buildRepresentation(f, products)
+		if err != nil {
+			return nil, err
+		}
+		entry.representations[name] = rep
+	}
+	return entry, nil
+}
+
+func buildRepresentation(f format, products []*inventory.Product) (*representation, error) {
+	var identity bytes.Buffer
+	if err := f.encode(&identity, products); err != nil {
+		return nil, err
+	}
+	hash := fnv.New64a()
+	_, _ = hash.Write(identity.Bytes())
+	rep := &representation{
+		etag:    fmt.Sprintf(`W/"%x"`, hash.Sum64()),
+		encoded: map[string][]byte{encodingIdentity: identity.Bytes()},
+	}
+	for _, encoding := range supportedEncodings {
+		if encoding == encodingIdentity {
+			continue
+		}
+		var buf bytes.Buffer
+		enc := newEncoder(encoding, &buf)
+		if _, err := enc.Write(identity.Bytes()); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+		rep.encoded[encoding] = buf.Bytes()
+	}
+	return rep, nil
+}
+
+func categoryProducts(api WarehouseAPI, ctg string) ([]*inventory.Product, error) {
+	prodIt, err := api.ProductsCategory(ctg)
+	if err != nil {
+		return nil, err
+	}
+	var data []*inventory.Product
+	for prodIt.Next() {
+		data = append(data, prodIt.Product())
+	}
+	return data, nil
+}
+
+func latestRetrievedAt(products []*inventory.Product) time.Time {
+	var latest time.Time
+	for _, product := range products {
+		if product.RetrievedAt.After(latest) {
+			latest = product.RetrievedAt
+		}
+	}
+	return latest
+}
+
+// notModified reports whether the request's conditional headers match the
+// current representation. If-None-Match takes precedence over
+// If-Modified-Since.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		return err == nil && !lastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package frontend
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nikunicke/reaktorw/warehouse/inventory"
+	"github.com/nikunicke/reaktorw/warehouse/store/memory"
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(CacheTestSuite))
+
+type CacheTestSuite struct {
+	warehouse *memory.InMemoryWarehouse
+	svc       *Service
+}
+
+func (s *CacheTestSuite) SetUpTest(c *check.C) {
+	s.warehouse = newTestWarehouse(c)
+	s.svc = newTestService(c, s.warehouse)
+}
+
+func (s *CacheTestSuite) TestValidators(c *check.C) {
+	w := serve(s.svc, http.MethodGet, "/products/gloves/")
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+	c.Assert(strings.HasPrefix(w.Header().Get("ETag"), `W/"`), check.Equals, true, check.Commentf("ETag %q", w.Header().Get("ETag")))
+	c.Assert(w.Header().Get("Last-Modified"), check.Equals, retrievedAt.Format(http.TimeFormat))
+	c.Assert(w.Header().Get("Cache-Control"), check.Equals, "no-cache")
+
+	// Each format is a representation of its own.
+	csv := serve(s.svc, http.MethodGet, "/products/gloves/?format=csv")
+	c.Assert(csv.Header().Get("ETag"), check.Not(check.Equals), w.Header().Get("ETag"))
+}
+
+func (s *CacheTestSuite) TestIfNoneMatch(c *check.C) {
+	etag := serve(s.svc, http.MethodGet, "/products/gloves/").Header().Get("ETag")
+
+	for _, inm := range []string{etag, strings.TrimPrefix(etag, "W/"), `"other", ` + etag, "*"} {
+		w := serve(s.svc, http.MethodGet, "/products/gloves/", "If-None-Match", inm)
+		c.Assert(w.Code, check.Equals, http.StatusNotModified, check.Commentf("If-None-Match %q", inm))
+		c.Assert(w.Body.Len(), check.Equals, 0)
+		c.Assert(w.Header().Get("ETag"), check.Equals, etag)
+	}
+	w := serve(s.svc, http.MethodGet, "/products/gloves/", "If-None-Match", `W/"other"`)
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+}
+
+func (s *CacheTestSuite) TestIfNoneMatchAfterUpdate(c *check.C) {
+	etag := serve(s.svc, http.MethodGet, "/products/gloves/").Header().Get("ETag")
+	c.Assert(s.warehouse.UpsertAvailability(&inventory.Availability{APIID: "g1", Status: "OUTOFSTOCK"}), check.IsNil)
+
+	// The cache only changes once it is rebuilt.
+	w := serve(s.svc, http.MethodGet, "/products/gloves/", "If-None-Match", etag)
+	c.Assert(w.Code, check.Equals, http.StatusNotModified)
+	c.Assert(s.svc.Rebuild(), check.IsNil)
+	w = serve(s.svc, http.MethodGet, "/products/gloves/", "If-None-Match", etag)
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+	c.Assert(w.Header().Get("ETag"), check.Not(check.Equals), etag)
+	c.Assert(strings.Contains(w.Body.String(), "OUTOFSTOCK"), check.Equals, true)
+}
+
+func (s *CacheTestSuite) TestIfModifiedSince(c *check.C) {
+	for _, t := range []struct {
+		since  time.Time
+		status int
+	}{
+		{retrievedAt, http.StatusNotModified},
+		{retrievedAt.Add(time.Hour), http.StatusNotModified},
+		{retrievedAt.Add(-time.Second), http.StatusOK},
+	} {
+		w := serve(s.svc, http.MethodGet, "/products/gloves/", "If-Modified-Since", t.since.Format(http.TimeFormat))
+		c.Assert(w.Code, check.Equals, t.status, check.Commentf("If-Modified-Since %v", t.since))
+	}
+
+	// If-None-Match takes precedence.
+	w := serve(s.svc, http.MethodGet, "/products/gloves/",
+		"If-None-Match", `W/"other"`, "If-Modified-Since", retrievedAt.Format(http.TimeFormat))
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+}
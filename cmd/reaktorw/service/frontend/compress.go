@@ -0,0 +1,122 @@
+package frontend
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	encodingBrotli   = "br"
+	encodingGzip     = "gzip"
+	encodingIdentity = "identity"
+)
+
+// supportedEncodings lists the content codings in order of preference.
+var supportedEncodings = []string{encodingBrotli, encodingGzip, encodingIdentity}
+
+// negotiateEncoding picks the preferred content coding accepted by the client.
+// Identity is used when the header is empty or nothing else is acceptable.
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := parseQualityList(acceptEncoding)
+	best, bestQ := encodingIdentity, 0.0
+	for _, encoding := range supportedEncodings {
+		q := -1.0
+		for _, qv := range accepted {
+			if qv.value == encoding {
+				q = qv.q
+				break
+			}
+			if qv.value == "*" && q < 0 {
+				q = qv.q
+			}
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compress is a middleware that encodes response bodies with the content
+// coding negotiated from the Accept-Encoding request header. Responses that
+// already carry a Content-Encoding, partial content and bodiless statuses are
+// passed through untouched. The bodies of responses to HEAD requests are
+// discarded.
+func compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       negotiateEncoding(r.Header.Get("Accept-Encoding")),
+			head:           r.Method == http.MethodHead,
+		}
+		defer func() { _ = cw.Close() }()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+
+	encoding    string
+	encoder     io.WriteCloser
+	wroteHeader bool
+	head        bool
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	h := cw.Header()
+	if cw.encoding != encodingIdentity && bodyAllowed(status) &&
+		status != http.StatusPartialContent && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		if !cw.head {
+			cw.encoder = newEncoder(cw.encoding, cw.ResponseWriter)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		// Sniff the uncompressed bytes, net/http would otherwise sniff the
+		// encoded body.
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.head {
+		return len(b), nil
+	}
+	if cw.encoder == nil {
+		return cw.ResponseWriter.Write(b)
+	}
+	return cw.encoder.Write(b)
+}
+
+// Close flushes any buffered encoded data to the underlying writer.
+func (cw *compressWriter) Close() error {
+	if cw.encoder == nil {
+		return nil
+	}
+	return cw.encoder.Close()
+}
+
+func newEncoder(encoding string, w io.Writer) io.WriteCloser {
+	if encoding == encodingBrotli {
+		return brotli.NewWriter(w)
+	}
+	return gzip.NewWriter(w)
+}
+
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
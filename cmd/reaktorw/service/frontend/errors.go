@@ -0,0 +1,83 @@
+package frontend
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/nikunicke/reaktorw/badapi"
+	"github.com/nikunicke/reaktorw/cmd/reaktorw/service/httpapi"
+	"github.com/nikunicke/reaktorw/warehouse/inventory"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+var (
+	errInvalidProductID = xerrors.New("frontend: product ID is not a valid UUID")
+	errUnknownFormat    = xerrors.New("frontend: unknown format")
+	errNotAcceptable    = xerrors.New("frontend: no acceptable format")
+	errNotFound         = xerrors.New("frontend: not found")
+	errMethodNotAllowed = xerrors.New("frontend: method not allowed")
+)
+
+// classifyError maps err to an HTTP status, an error code and a message that
+// is safe to expose to clients.
+func classifyError(err error) (int, string, string) {
+	var (
+		invErr    *inventory.Error
+		badapiErr *badapi.Error
+	)
+	switch {
+	case xerrors.As(err, &invErr):
+		status := http.StatusNotFound
+		if invErr == inventory.ErrAvailabilityForUnknownProduct {
+			status = http.StatusConflict
+		}
+		return status, invErr.Code, invErr.Error()
+	case xerrors.Is(err, errInvalidProductID):
+		return http.StatusBadRequest, "invalid_product_id", err.Error()
+	case xerrors.Is(err, errUnknownFormat):
+		return http.StatusBadRequest, "unknown_format", err.Error()
+	case xerrors.Is(err, errNotAcceptable):
+		return http.StatusNotAcceptable, "not_acceptable", err.Error()
+	case xerrors.Is(err, errNotFound):
+		return http.StatusNotFound, "not_found", err.Error()
+	case xerrors.Is(err, errMethodNotAllowed):
+		return http.StatusMethodNotAllowed, "method_not_allowed", err.Error()
+	case xerrors.Is(err, errNotReady):
+		return http.StatusServiceUnavailable, "not_ready", err.Error()
+	case xerrors.Is(err, badapi.ErrModeActive):
+		return http.StatusBadGateway, "upstream_error_mode_active", err.Error()
+	case xerrors.Is(err, badapi.ErrEmptyBody):
+		return http.StatusBadGateway, "upstream_empty_body", err.Error()
+	case xerrors.As(err, &badapiErr):
+		return http.StatusBadGateway, "upstream_error", "badapi: upstream request failed"
+	default:
+		return http.StatusInternalServerError, "internal_error", "internal server error"
+	}
+}
+
+// writeError writes the error envelope for err. Server side errors, other than
+// the warehouse not being ready yet, are logged with the request scoped logger.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status, code, message := classifyError(err)
+	if status >= http.StatusInternalServerError && status != http.StatusServiceUnavailable {
+		httpapi.RequestLogger(r).WithFields(logrus.Fields{
+			"error":  err,
+			"status": status,
+		}).Error("request failed")
+	}
+	httpapi.WriteError(w, r, status, code, message)
+}
+
+// methodNotAllowed returns a handler responding with 405. It is routed after
+// the handlers of a path, so only requests with other methods reach it.
+func methodNotAllowed(allowed ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, r, errMethodNotAllowed)
+	}
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, errNotFound)
+}
@@ -0,0 +1,96 @@
+package frontend
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/nikunicke/reaktorw/badapi"
+	"github.com/nikunicke/reaktorw/cmd/reaktorw/service/updater"
+	"github.com/nikunicke/reaktorw/warehouse/inventory"
+	"github.com/nikunicke/reaktorw/warehouse/store/memory"
+	"golang.org/x/xerrors"
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(ErrorsTestSuite))
+
+type ErrorsTestSuite struct{}
+
+// failingWarehouse fails every availability lookup with err.
+type failingWarehouse struct {
+	*memory.InMemoryWarehouse
+	err error
+}
+
+func (w failingWarehouse) FindAvailabilityByAPIID(string) (*inventory.Availability, error) {
+	return nil, w.err
+}
+
+type statusStub updater.Status
+
+func (s statusStub) Status() updater.Status { return updater.Status(s) }
+
+func (s *ErrorsTestSuite) TestRequestID(c *check.C) {
+	svc := newTestService(c, newTestWarehouse(c))
+
+	w := serve(svc, http.MethodGet, "/api/v1/products/by-api-id/nope", "X-Request-ID", "req-1")
+	c.Assert(w.Header().Get("X-Request-ID"), check.Equals, "req-1")
+	assertError(c, w, http.StatusNotFound, "unknown_product_id")
+
+	// Without one, or with an overly long one, an ID is generated.
+	for _, id := range []string{"", strings.Repeat("x", 129)} {
+		w = serve(svc, http.MethodGet, "/api/v1/products/by-api-id/nope", "X-Request-ID", id)
+		c.Assert(w.Header().Get("X-Request-ID"), check.HasLen, 36)
+		assertError(c, w, http.StatusNotFound, "unknown_product_id")
+	}
+}
+
+func (s *ErrorsTestSuite) TestNoDataForCategory(c *check.C) {
+	svc := newTestService(c, newTestWarehouse(c))
+
+	w := serve(svc, http.MethodGet, "/products/facemasks/")
+	assertError(c, w, http.StatusNotFound, "no_data_for_category")
+}
+
+func (s *ErrorsTestSuite) TestNotReady(c *check.C) {
+	svc, err := NewService(Config{
+		WarehouseAPI: newTestWarehouse(c),
+		StatusAPI:    statusStub{},
+		ListenAddr:   ":0",
+	})
+	c.Assert(err, check.IsNil)
+
+	for _, target := range []string{"/readyz", "/products/gloves/", "/api/v1/products/by-api-id/g1"} {
+		w := serve(svc, http.MethodGet, target)
+		assertError(c, w, http.StatusServiceUnavailable, "not_ready")
+		c.Assert(w.Header().Get("Retry-After"), check.Equals, "15")
+	}
+}
+
+func (s *ErrorsTestSuite) TestInternalErrorsAreNotExposed(c *check.C) {
+	api := failingWarehouse{newTestWarehouse(c), xerrors.New("disk on fire")}
+	svc := newTestService(c, api)
+
+	w := serve(svc, http.MethodGet, "/api/v1/products/by-api-id/g1")
+	envelope := assertError(c, w, http.StatusInternalServerError, "internal_error")
+	c.Assert(envelope.Message, check.Equals, "internal server error")
+}
+
+func (s *ErrorsTestSuite) TestUpstreamErrors(c *check.C) {
+	for _, t := range []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{badapi.ErrModeActive, http.StatusBadGateway, "upstream_error_mode_active"},
+		{xerrors.Errorf("loading: %w", badapi.ErrEmptyBody), http.StatusBadGateway, "upstream_empty_body"},
+		{&badapi.Error{Code: 500, Body: "secret"}, http.StatusBadGateway, "upstream_error"},
+		{inventory.ErrAvailabilityForUnknownProduct, http.StatusConflict, "availability_for_unknown_product"},
+	} {
+		svc := newTestService(c, failingWarehouse{newTestWarehouse(c), t.err})
+
+		w := serve(svc, http.MethodGet, "/api/v1/products/by-api-id/g1")
+		envelope := assertError(c, w, t.status, t.code)
+		c.Assert(strings.Contains(envelope.Message, "secret"), check.Equals, false)
+	}
+}
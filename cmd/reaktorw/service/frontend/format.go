@@ -0,0 +1,108 @@
+package frontend
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikunicke/reaktorw/warehouse/inventory"
+)
+
+// format is a representation the product listings can be served in.
+type format struct {
+	name        string
+	contentType string
+	encode      func(w io.Writer, products []*inventory.Product) error
+}
+
+var (
+	formatJSON   = format{name: "json", contentType: "application/json", encode: encodeJSON}
+	formatCSV    = format{name: "csv", contentType: "text/csv; charset=utf-8", encode: encodeCSV}
+	formatNDJSON = format{name: "ndjson", contentType: "application/x-ndjson", encode: encodeNDJSON}
+
+	formats = map[string]format{
+		formatJSON.name:   formatJSON,
+		formatCSV.name:    formatCSV,
+		formatNDJSON.name: formatNDJSON,
+	}
+
+	// mediaTypeFormats maps the Accept header media ranges to formats.
+	mediaTypeFormats = map[string]format{
+		"*/*":                  formatJSON,
+		"application/*":        formatJSON,
+		"application/json":     formatJSON,
+		"text/*":               formatCSV,
+		"text/csv":             formatCSV,
+		"application/x-ndjson": formatNDJSON,
+		"application/ndjson":   formatNDJSON,
+	}
+)
+
+// negotiateFormat returns the format requested with the format= query
+// parameter or, when absent, the Accept header. JSON is the default.
+func negotiateFormat(query, accept string) (format, error) {
+	if query != "" {
+		f, ok := formats[strings.ToLower(query)]
+		if !ok {
+			return format{}, errUnknownFormat
+		}
+		return f, nil
+	}
+	if accept == "" {
+		return formatJSON, nil
+	}
+	for _, qv := range parseQualityList(accept) {
+		if qv.q <= 0 {
+			continue
+		}
+		if f, ok := mediaTypeFormats[qv.value]; ok {
+			return f, nil
+		}
+	}
+	return format{}, errNotAcceptable
+}
+
+func encodeJSON(w io.Writer, products []*inventory.Product) error {
+	return json.NewEncoder(w).Encode(products)
+}
+
+func encodeNDJSON(w io.Writer, products []*inventory.Product) error {
+	enc := json.NewEncoder(w)
+	for _, product := range products {
+		if err := enc.Encode(product); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var csvHeader = []string{
+	"id", "api_id", "name", "category", "price", "colors", "manufacturer", "availability", "retrieved_at",
+}
+
+func encodeCSV(w io.Writer, products []*inventory.Product) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, product := range products {
+		if err := cw.Write([]string{
+			product.ID.String(),
+			product.APIID,
+			product.Name,
+			product.Category,
+			strconv.Itoa(int(product.Price)),
+			strings.Join(product.Colors, ";"),
+			product.Manufacturer,
+			product.Availability,
+			product.RetrievedAt.Format(time.RFC3339),
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
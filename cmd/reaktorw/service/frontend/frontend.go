@@ -1,28 +1,43 @@
 package frontend
 
 import (
-	"compress/gzip"
 	"context"
-	"encoding/json"
 	"html/template"
 	"io"
 	"io/ioutil"
-	"net"
 	"net/http"
+	"strconv"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/nikunicke/reaktorw/cmd/reaktorw/service/httpapi"
 	"github.com/nikunicke/reaktorw/warehouse/inventory"
 	"github.com/rs/cors"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/xerrors"
 )
 
+// categories served by the frontend.
+var categories = []string{"gloves", "facemasks", "beanies"}
+
 type WarehouseAPI interface {
 	ProductsCategory(ctg string) (inventory.ProductIterator, error)
+	CategoryVersion(ctg string) uint64
+	FindProduct(id uuid.UUID) (*inventory.Product, error)
+	FindProductByAPIID(apiID string) (*inventory.Product, error)
+	FindAvailabilityByAPIID(apiID string) (*inventory.Availability, error)
+}
+
+// MetricsAPI exposes metrics and instruments HTTP handlers.
+type MetricsAPI interface {
+	Handler() http.Handler
+	Middleware(next http.Handler) http.Handler
 }
 
 type Config struct {
 	WarehouseAPI WarehouseAPI
+	StatusAPI    StatusAPI
+	Metrics      MetricsAPI
 	ListenAddr   string
 
 	Logger *logrus.Entry
@@ -31,6 +46,7 @@ type Config struct {
 type Service struct {
 	conf   Config
 	router *mux.Router
+	cache  *categoryCache
 
 	tplExecutor func(tpl *template.Template, w io.Writer, data map[string]interface{}) error
 }
@@ -55,14 +71,35 @@ func NewService(conf Config) (*Service, error) {
 	service := &Service{
 		conf:   conf,
 		router: mux.NewRouter(),
+		cache:  newCategoryCache(),
 		tplExecutor: func(tpl *template.Template, w io.Writer, data map[string]interface{}) error {
 			return tpl.Execute(w, data)
 		},
 	}
-	service.router.Use(cors.Default().Handler)
-	service.router.HandleFunc("/products/gloves/", service.getGloves)
-	service.router.HandleFunc("/products/facemasks/", service.getFacemasks)
-	service.router.HandleFunc("/products/beanies/", service.getBeanies)
+	if err := service.Rebuild(); err != nil {
+		return nil, xerrors.Errorf("frontend service: initial cache build failed: %w", err)
+	}
+	service.router.Use(httpapi.WithRequestID(conf.Logger), cors.Default().Handler, compress)
+	if conf.Metrics != nil {
+		service.router.Use(conf.Metrics.Middleware)
+		service.router.Handle("/metrics", conf.Metrics.Handler()).Methods(http.MethodGet)
+	}
+	service.router.HandleFunc("/healthz", service.getHealthz).Methods(http.MethodGet)
+	service.router.HandleFunc("/readyz", service.getReadyz).Methods(http.MethodGet)
+	service.router.HandleFunc("/status", service.getStatus).Methods(http.MethodGet)
+
+	api := service.router.NewRoute().Subrouter()
+	api.Use(service.requireReady)
+	for _, ctg := range categories {
+		api.HandleFunc("/products/"+ctg+"/", service.getCategory(ctg)).Methods(http.MethodGet, http.MethodHead)
+		api.HandleFunc("/products/"+ctg+"/", methodNotAllowed(http.MethodGet, http.MethodHead))
+	}
+	api.HandleFunc("/api/v1/products/by-api-id/{api_id}", service.getProductByAPIID).Methods(http.MethodGet)
+	api.HandleFunc("/api/v1/products/by-api-id/{api_id}", methodNotAllowed(http.MethodGet))
+	api.HandleFunc("/api/v1/products/{id}", service.getProduct).Methods(http.MethodGet)
+	api.HandleFunc("/api/v1/products/{id}", methodNotAllowed(http.MethodGet))
+	// Unknown API paths get the error envelope, not the file server's 404.
+	api.PathPrefix("/api/").HandlerFunc(notFound)
 	fileServer := http.FileServer(http.Dir("./frontend-static/build"))
 	service.router.PathPrefix("/").Handler(fileServer)
 	return service, nil
@@ -70,95 +107,58 @@ func NewService(conf Config) (*Service, error) {
 
 func (s *Service) Name() string { return "frontend" }
 
+// Rebuild replaces the cached category listings with fresh ones built from the
+// warehouse. It should be called whenever a warehouse update completes.
+func (s *Service) Rebuild() error {
+	return s.cache.rebuild(s.conf.WarehouseAPI, categories)
+}
+
 func (s *Service) Run(ctx context.Context) error {
 	s.conf.Logger.WithField("listening on", s.conf.ListenAddr).Info("starting service")
 	defer s.conf.Logger.Info("stopped service")
-	l, err := net.Listen("tcp", s.conf.ListenAddr)
-	if err != nil {
-		return err
-	}
-	defer func() { _ = l.Close() }()
-	server := &http.Server{
-		Addr:    s.conf.ListenAddr,
-		Handler: s.router,
-	}
-	go func() {
-		<-ctx.Done()
-		_ = server.Close()
-	}()
-	if err = server.Serve(l); err == http.ErrServerClosed {
-		err = nil
-	}
-	return err
+	return httpapi.Serve(ctx, s.conf.ListenAddr, s.router)
 }
 
-func (s *Service) getGloves(w http.ResponseWriter, r *http.Request) {
-	products, err := s.getCategory("gloves")
-	if err != nil && err != inventory.ErrNoDataForCategory {
-		w.WriteHeader(500)
-		return
-	}
-	w.Header().Add("Content-Encoding", "gzip")
-	w.Header().Add("Content-Type", "application/json")
-	bytes, err := json.Marshal(products)
-	if err != nil {
-		w.WriteHeader(500)
-		return
-	}
-	gWriter := gzip.NewWriter(w)
-	defer gWriter.Close()
-	if _, err := gWriter.Write(bytes); err != nil {
-		w.WriteHeader(500)
-		return
-	}
-}
-func (s *Service) getFacemasks(w http.ResponseWriter, r *http.Request) {
-	products, err := s.getCategory("facemasks")
-	if err != nil && err != inventory.ErrNoDataForCategory {
-		w.WriteHeader(500)
-		return
-	}
-	w.Header().Add("Content-Encoding", "gzip")
-	bytes, err := json.Marshal(products)
-	if err != nil {
-		w.WriteHeader(500)
-		return
-	}
-	gWriter := gzip.NewWriter(w)
-	defer gWriter.Close()
-	if _, err := gWriter.Write(bytes); err != nil {
-		w.WriteHeader(500)
-		return
-	}
-}
-func (s *Service) getBeanies(w http.ResponseWriter, r *http.Request) {
-	products, err := s.getCategory("beanies")
-	if err != nil && err != inventory.ErrNoDataForCategory {
-		w.WriteHeader(500)
-		return
-	}
-	w.Header().Add("Content-Encoding", "gzip")
-	bytes, err := json.Marshal(products)
-	if err != nil {
-		w.WriteHeader(500)
-		return
-	}
-	gWriter := gzip.NewWriter(w)
-	defer gWriter.Close()
-	if _, err := gWriter.Write(bytes); err != nil {
-		w.WriteHeader(500)
-		return
-	}
-}
-
-func (s *Service) getCategory(ctg string) ([]*inventory.Product, error) {
-	prodIt, err := s.conf.WarehouseAPI.ProductsCategory(ctg)
-	if err != nil {
-		return nil, err
-	}
-	var data []*inventory.Product
-	for prodIt.Next() {
-		data = append(data, prodIt.Product())
+// getCategory returns a handler serving the products of a category in the
+// format negotiated with the client.
+func (s *Service) getCategory(ctg string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		f, err := negotiateFormat(r.URL.Query().Get("format"), r.Header.Get("Accept"))
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		entry := s.cache.lookup(ctg)
+		if entry == nil {
+			writeError(w, r, xerrors.Errorf("no cached entry for category %q", ctg))
+			return
+		}
+		if entry.err != nil {
+			writeError(w, r, entry.err)
+			return
+		}
+		rep := entry.representations[f.name]
+		w.Header().Set("ETag", rep.etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		if !entry.lastModified.IsZero() {
+			w.Header().Set("Last-Modified", entry.lastModified.UTC().Format(http.TimeFormat))
+		}
+		if notModified(r, rep.etag, entry.lastModified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		body := rep.encoded[encoding]
+		if encoding != encodingIdentity {
+			w.Header().Set("Content-Encoding", encoding)
+		}
+		w.Header().Set("Content-Type", f.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		_, _ = w.Write(body)
 	}
-	return data, nil
 }
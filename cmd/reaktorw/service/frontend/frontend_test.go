@@ -0,0 +1,61 @@
+package frontend
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nikunicke/reaktorw/cmd/reaktorw/service/httpapi"
+	"github.com/nikunicke/reaktorw/warehouse/inventory"
+	"github.com/nikunicke/reaktorw/warehouse/store/memory"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+// retrievedAt stamps the products of the test warehouse.
+var retrievedAt = time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestWarehouse returns a warehouse holding a glove with an availability
+// and a beanie without one. Facemasks have no data.
+func newTestWarehouse(c *check.C) *memory.InMemoryWarehouse {
+	warehouse := memory.NewInMemoryWarehouse()
+	c.Assert(warehouse.UpsertProduct(&inventory.Product{
+		APIID: "g1", Name: "glove", Category: "gloves", Manufacturer: "okkau", RetrievedAt: retrievedAt,
+	}), check.IsNil)
+	c.Assert(warehouse.UpsertProduct(&inventory.Product{
+		APIID: "b1", Name: "beanie", Category: "beanies", Manufacturer: "okkau", RetrievedAt: retrievedAt,
+	}), check.IsNil)
+	c.Assert(warehouse.UpsertAvailability(&inventory.Availability{APIID: "g1", Status: "INSTOCK"}), check.IsNil)
+	return warehouse
+}
+
+func newTestService(c *check.C, api WarehouseAPI) *Service {
+	svc, err := NewService(Config{WarehouseAPI: api, ListenAddr: ":0"})
+	c.Assert(err, check.IsNil)
+	return svc
+}
+
+// serve sends a request to the service's router, applying each of header to
+// it, and returns the recorded response.
+func serve(svc *Service, method, target string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	svc.router.ServeHTTP(w, r)
+	return w
+}
+
+// assertError checks that w holds an error envelope with status and code.
+func assertError(c *check.C, w *httptest.ResponseRecorder, status int, code string) httpapi.ErrorEnvelope {
+	c.Assert(w.Code, check.Equals, status, check.Commentf("body: %s", w.Body))
+	c.Assert(w.Header().Get("Content-Type"), check.Equals, "application/json")
+	var envelope httpapi.ErrorEnvelope
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &envelope), check.IsNil)
+	c.Assert(envelope.Code, check.Equals, code)
+	c.Assert(envelope.RequestID, check.Equals, w.Header().Get("X-Request-ID"))
+	return envelope
+}
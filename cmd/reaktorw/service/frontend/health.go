@@ -0,0 +1,61 @@
+package frontend
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nikunicke/reaktorw/cmd/reaktorw/service/httpapi"
+	"github.com/nikunicke/reaktorw/cmd/reaktorw/service/updater"
+	"golang.org/x/xerrors"
+)
+
+// retryAfter is advertised to clients while the warehouse is not ready. The
+// first update takes roughly this long.
+const retryAfter = 15 * time.Second
+
+var errNotReady = xerrors.New("frontend: warehouse not ready")
+
+type StatusAPI interface {
+	Status() updater.Status
+}
+
+// ready reports whether the first warehouse update has completed. Without a
+// StatusAPI the warehouse is assumed to be ready.
+func (s *Service) ready() bool {
+	return s.conf.StatusAPI == nil || s.conf.StatusAPI.Status().Ready
+}
+
+// requireReady is a middleware that responds with 503 until the warehouse is
+// ready.
+func (s *Service) requireReady(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.ready() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			writeError(w, r, errNotReady)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Service) getHealthz(w http.ResponseWriter, r *http.Request) {
+	httpapi.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Service) getReadyz(w http.ResponseWriter, r *http.Request) {
+	if !s.ready() {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+		writeError(w, r, errNotReady)
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+func (s *Service) getStatus(w http.ResponseWriter, r *http.Request) {
+	status := updater.Status{Ready: true}
+	if s.conf.StatusAPI != nil {
+		status = s.conf.StatusAPI.Status()
+	}
+	httpapi.WriteJSON(w, http.StatusOK, status)
+}
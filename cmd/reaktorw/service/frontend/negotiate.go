@@ -0,0 +1,40 @@
+package frontend
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// qualityValue is a single entry of an Accept-style header such as
+// "gzip;q=0.8" or "application/json".
+type qualityValue struct {
+	value string
+	q     float64
+}
+
+// parseQualityList parses an Accept-style header into its entries ordered by
+// descending quality. Entries of equal quality keep their original order.
+func parseQualityList(header string) []qualityValue {
+	var values []qualityValue
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		value := strings.ToLower(strings.TrimSpace(fields[0]))
+		if value == "" {
+			continue
+		}
+		qv := qualityValue{value: value, q: 1}
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+				qv.q = q
+			}
+		}
+		values = append(values, qv)
+	}
+	sort.SliceStable(values, func(i, j int) bool { return values[i].q > values[j].q })
+	return values
+}
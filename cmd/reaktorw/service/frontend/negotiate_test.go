@@ -0,0 +1,118 @@
+package frontend
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/andybalholm/brotli"
+	"github.com/nikunicke/reaktorw/warehouse/inventory"
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(NegotiateTestSuite))
+
+type NegotiateTestSuite struct {
+	svc *Service
+}
+
+func (s *NegotiateTestSuite) SetUpTest(c *check.C) {
+	s.svc = newTestService(c, newTestWarehouse(c))
+}
+
+func (s *NegotiateTestSuite) TestJSONByDefault(c *check.C) {
+	w := serve(s.svc, http.MethodGet, "/products/gloves/")
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+	c.Assert(w.Header().Get("Content-Type"), check.Equals, "application/json")
+	var products []*inventory.Product
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &products), check.IsNil)
+	c.Assert(products, check.HasLen, 1)
+	c.Assert(products[0].Availability, check.Equals, "INSTOCK")
+}
+
+func (s *NegotiateTestSuite) TestCSV(c *check.C) {
+	// The format parameter overrides the Accept header.
+	for _, target := range []string{"/products/gloves/", "/products/gloves/?format=csv"} {
+		accept := "text/csv"
+		if target != "/products/gloves/" {
+			accept = "application/json"
+		}
+		w := serve(s.svc, http.MethodGet, target, "Accept", accept)
+		c.Assert(w.Code, check.Equals, http.StatusOK)
+		c.Assert(w.Header().Get("Content-Type"), check.Equals, "text/csv; charset=utf-8")
+		records, err := csv.NewReader(w.Body).ReadAll()
+		c.Assert(err, check.IsNil)
+		c.Assert(records, check.HasLen, 2)
+		c.Assert(records[0], check.DeepEquals, csvHeader)
+		c.Assert(records[1][1], check.Equals, "g1")
+	}
+}
+
+func (s *NegotiateTestSuite) TestNDJSON(c *check.C) {
+	w := serve(s.svc, http.MethodGet, "/products/gloves/", "Accept", "text/html;q=0.9, application/x-ndjson")
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+	c.Assert(w.Header().Get("Content-Type"), check.Equals, "application/x-ndjson")
+	var lines int
+	for scanner := bufio.NewScanner(w.Body); scanner.Scan(); lines++ {
+		var product inventory.Product
+		c.Assert(json.Unmarshal(scanner.Bytes(), &product), check.IsNil)
+		c.Assert(product.APIID, check.Equals, "g1")
+	}
+	c.Assert(lines, check.Equals, 1)
+}
+
+func (s *NegotiateTestSuite) TestNotAcceptable(c *check.C) {
+	w := serve(s.svc, http.MethodGet, "/products/gloves/", "Accept", "text/html, application/json;q=0")
+	assertError(c, w, http.StatusNotAcceptable, "not_acceptable")
+	w = serve(s.svc, http.MethodGet, "/products/gloves/?format=xml")
+	assertError(c, w, http.StatusBadRequest, "unknown_format")
+}
+
+func (s *NegotiateTestSuite) TestEncodings(c *check.C) {
+	identity := serve(s.svc, http.MethodGet, "/products/gloves/").Body.Bytes()
+
+	w := serve(s.svc, http.MethodGet, "/products/gloves/", "Accept-Encoding", "gzip")
+	c.Assert(w.Header().Get("Content-Encoding"), check.Equals, "gzip")
+	zr, err := gzip.NewReader(w.Body)
+	c.Assert(err, check.IsNil)
+	body, err := ioutil.ReadAll(zr)
+	c.Assert(err, check.IsNil)
+	c.Assert(body, check.DeepEquals, identity)
+
+	// Brotli is preferred when the client accepts both.
+	w = serve(s.svc, http.MethodGet, "/products/gloves/", "Accept-Encoding", "gzip, br")
+	c.Assert(w.Header().Get("Content-Encoding"), check.Equals, "br")
+	body, err = ioutil.ReadAll(brotli.NewReader(w.Body))
+	c.Assert(err, check.IsNil)
+	c.Assert(body, check.DeepEquals, identity)
+
+	w = serve(s.svc, http.MethodGet, "/products/gloves/", "Accept-Encoding", "br;q=0, gzip;q=0")
+	c.Assert(w.Header().Get("Content-Encoding"), check.Equals, "")
+	c.Assert(w.Body.Bytes(), check.DeepEquals, identity)
+}
+
+func (s *NegotiateTestSuite) TestHeadHasNoBody(c *check.C) {
+	get := serve(s.svc, http.MethodGet, "/products/gloves/", "Accept-Encoding", "br")
+	head := serve(s.svc, http.MethodHead, "/products/gloves/", "Accept-Encoding", "br")
+	c.Assert(head.Code, check.Equals, http.StatusOK)
+	c.Assert(head.Body.Len(), check.Equals, 0)
+	c.Assert(head.Header().Get("Content-Encoding"), check.Equals, "br")
+	c.Assert(head.Header().Get("Content-Length"), check.Equals, strconv.Itoa(get.Body.Len()))
+
+	// Bodies compressed on the fly, such as error envelopes, are discarded
+	// too.
+	head = serve(s.svc, http.MethodHead, "/products/gloves/?format=xml", "Accept-Encoding", "gzip")
+	c.Assert(head.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(head.Header().Get("Content-Encoding"), check.Equals, "gzip")
+	c.Assert(head.Body.Len(), check.Equals, 0)
+}
+
+func (s *NegotiateTestSuite) TestWrongMethod(c *check.C) {
+	w := serve(s.svc, http.MethodPost, "/products/gloves/")
+	assertError(c, w, http.StatusMethodNotAllowed, "method_not_allowed")
+	c.Assert(w.Header().Get("Allow"), check.Equals, "GET, HEAD")
+}
@@ -0,0 +1,51 @@
+package frontend
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/nikunicke/reaktorw/cmd/reaktorw/service/httpapi"
+	"github.com/nikunicke/reaktorw/warehouse/inventory"
+	"golang.org/x/xerrors"
+)
+
+// productDetails is the response body of the single product lookup endpoints.
+// Availability is nil if no availability data has been stored for the product.
+type productDetails struct {
+	Product      *inventory.Product      `json:"product"`
+	Availability *inventory.Availability `json:"availability"`
+}
+
+func (s *Service) getProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, errInvalidProductID)
+		return
+	}
+	product, err := s.conf.WarehouseAPI.FindProduct(id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.writeProductDetails(w, r, product)
+}
+
+func (s *Service) getProductByAPIID(w http.ResponseWriter, r *http.Request) {
+	product, err := s.conf.WarehouseAPI.FindProductByAPIID(strings.ToLower(mux.Vars(r)["api_id"]))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.writeProductDetails(w, r, product)
+}
+
+func (s *Service) writeProductDetails(w http.ResponseWriter, r *http.Request, product *inventory.Product) {
+	availability, err := s.conf.WarehouseAPI.FindAvailabilityByAPIID(product.APIID)
+	if err != nil && !xerrors.Is(err, inventory.ErrUnknownAvailabilityID) {
+		writeError(w, r, err)
+		return
+	}
+	httpapi.WriteJSON(w, http.StatusOK, productDetails{Product: product, Availability: availability})
+}
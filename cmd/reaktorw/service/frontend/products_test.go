@@ -0,0 +1,70 @@
+package frontend
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(ProductsTestSuite))
+
+type ProductsTestSuite struct {
+	svc *Service
+}
+
+func (s *ProductsTestSuite) SetUpTest(c *check.C) {
+	s.svc = newTestService(c, newTestWarehouse(c))
+}
+
+func (s *ProductsTestSuite) details(c *check.C, target string) productDetails {
+	w := serve(s.svc, http.MethodGet, target)
+	c.Assert(w.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", w.Body))
+	c.Assert(w.Header().Get("Content-Type"), check.Equals, "application/json")
+	var details productDetails
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &details), check.IsNil)
+	return details
+}
+
+func (s *ProductsTestSuite) TestLookupByAPIID(c *check.C) {
+	// API IDs are matched case insensitively.
+	details := s.details(c, "/api/v1/products/by-api-id/G1")
+	c.Assert(details.Product.Name, check.Equals, "glove")
+	c.Assert(details.Availability, check.NotNil)
+	c.Assert(details.Availability.Status, check.Equals, "INSTOCK")
+	c.Assert(details.Availability.UpdatedAt.IsZero(), check.Equals, false)
+}
+
+func (s *ProductsTestSuite) TestLookupByID(c *check.C) {
+	beanie := s.details(c, "/api/v1/products/by-api-id/b1").Product
+
+	details := s.details(c, "/api/v1/products/"+beanie.ID.String())
+	c.Assert(details.Product.APIID, check.Equals, "b1")
+	// The beanie has no availability stored.
+	c.Assert(details.Availability, check.IsNil)
+}
+
+func (s *ProductsTestSuite) TestUnknownProduct(c *check.C) {
+	w := serve(s.svc, http.MethodGet, "/api/v1/products/by-api-id/nope")
+	assertError(c, w, http.StatusNotFound, "unknown_product_id")
+	w = serve(s.svc, http.MethodGet, "/api/v1/products/00000000-0000-0000-0000-000000000001")
+	assertError(c, w, http.StatusNotFound, "unknown_product_id")
+}
+
+func (s *ProductsTestSuite) TestInvalidProductID(c *check.C) {
+	w := serve(s.svc, http.MethodGet, "/api/v1/products/not-a-uuid")
+	assertError(c, w, http.StatusBadRequest, "invalid_product_id")
+}
+
+func (s *ProductsTestSuite) TestWrongMethod(c *check.C) {
+	for _, target := range []string{"/api/v1/products/by-api-id/g1", "/api/v1/products/not-a-uuid"} {
+		w := serve(s.svc, http.MethodPost, target)
+		assertError(c, w, http.StatusMethodNotAllowed, "method_not_allowed")
+		c.Assert(w.Header().Get("Allow"), check.Equals, http.MethodGet)
+	}
+}
+
+func (s *ProductsTestSuite) TestUnknownAPIPath(c *check.C) {
+	w := serve(s.svc, http.MethodGet, "/api/v1/nope")
+	assertError(c, w, http.StatusNotFound, "not_found")
+}
@@ -0,0 +1,60 @@
+// Package httpapi holds the helpers shared by the HTTP services of the
+// reaktor warehouse application.
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+)
+
+// ErrorEnvelope is the body of every error response of the HTTP APIs.
+type ErrorEnvelope struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+}
+
+// WriteError writes an error envelope carrying the ID of r.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	WriteJSON(w, status, ErrorEnvelope{
+		Code:      code,
+		Message:   message,
+		RequestID: RequestID(r),
+	})
+}
+
+// WriteJSON marshals v before writing any headers, so that an encoding failure
+// can still be reported with a 500.
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(bytes)
+}
+
+// Serve serves handler on addr until ctx is cancelled.
+func Serve(ctx context.Context, addr string, handler http.Handler) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = l.Close() }()
+	server := &http.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	if err = server.Serve(l); err == http.ErrServerClosed {
+		err = nil
+	}
+	return err
+}
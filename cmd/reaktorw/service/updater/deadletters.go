@@ -0,0 +1,51 @@
+package updater
+
+import (
+	"time"
+
+	updater_pipeline "github.com/nikunicke/reaktorw/updater"
+)
+
+// deadLetterHistorySize is the number of failed records kept for inspection.
+const deadLetterHistorySize = 100
+
+// DeadLetter is an upstream record the update pipelines failed to process.
+type DeadLetter struct {
+	Pipeline string    `json:"pipeline"`
+	Stage    int       `json:"stage"`
+	ID       string    `json:"id"`
+	Data     string    `json:"data"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// recordDeadLetter keeps a failed record for inspection. The failure itself
+// is logged by the pipeline's LogObserver.
+func (s *Service) recordDeadLetter(record updater_pipeline.FailedRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadLetters = append(s.deadLetters, DeadLetter{
+		Pipeline: record.Pipeline,
+		Stage:    record.StageIndex,
+		ID:       record.ID,
+		Data:     record.Data,
+		Error:    errorString(record.Err),
+		FailedAt: s.conf.Clock.Now(),
+	})
+	if len(s.deadLetters) > deadLetterHistorySize {
+		s.deadLetters = s.deadLetters[len(s.deadLetters)-deadLetterHistorySize:]
+	}
+}
+
+// DeadLetters returns the most recent records the update pipelines failed to
+// process, newest first.
+func (s *Service) DeadLetters() []DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deadLetters := make([]DeadLetter, len(s.deadLetters))
+	for i, deadLetter := range s.deadLetters {
+		deadLetters[len(s.deadLetters)-1-i] = deadLetter
+	}
+	return deadLetters
+}
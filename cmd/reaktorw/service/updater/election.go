@@ -0,0 +1,150 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// Lock elects the leader among replicas of the service. Only the leader
+// loads data from badapi.
+type Lock interface {
+	// Acquire takes or renews the lock and reports whether it is held.
+	Acquire(ctx context.Context) (bool, error)
+	// Release gives up the lock if it is held.
+	Release(ctx context.Context) error
+}
+
+// Roles reported in Status.
+const (
+	RoleLeader   = "leader"
+	RoleFollower = "follower"
+)
+
+// FileLock is a Lock backed by a lease file, for replicas sharing a file
+// system. The lease is taken over by another owner once it has not been
+// renewed for ttl. Replicas take turns updating the lease by holding an
+// exclusive flock on a guard file next to it.
+type FileLock struct {
+	path  string
+	owner string
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu sync.Mutex
+}
+
+type lease struct {
+	Owner     string    `json:"owner"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewFileLock returns a lock stored at path, held by owner.
+func NewFileLock(path, owner string, ttl time.Duration) *FileLock {
+	return &FileLock{path: path, owner: owner, ttl: ttl, now: time.Now}
+}
+
+// Acquire implements Lock.
+func (l *FileLock) Acquire(context.Context) (bool, error) {
+	var held bool
+	err := l.exclusive(func() error {
+		current, err := l.read()
+		if err != nil {
+			return err
+		}
+		now := l.now()
+		if current != nil && current.Owner != l.owner && now.Before(current.ExpiresAt) {
+			return nil
+		}
+		if err := l.write(lease{Owner: l.owner, ExpiresAt: now.Add(l.ttl)}); err != nil {
+			return err
+		}
+		held = true
+		return nil
+	})
+	return held, err
+}
+
+// Release implements Lock.
+func (l *FileLock) Release(context.Context) error {
+	return l.exclusive(func() error {
+		current, err := l.read()
+		if err != nil || current == nil || current.Owner != l.owner {
+			return err
+		}
+		if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+			return xerrors.Errorf("release lock: %w", err)
+		}
+		return nil
+	})
+}
+
+// exclusive runs fn while holding the guard of the lease, so that reading
+// and replacing the lease is atomic across replicas.
+func (l *FileLock) exclusive(fn func() error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	guard, err := os.OpenFile(l.path+".guard", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return xerrors.Errorf("open lock guard: %w", err)
+	}
+	defer guard.Close()
+	if err := lockFile(guard); err != nil {
+		return xerrors.Errorf("lock guard: %w", err)
+	}
+	defer unlockFile(guard)
+	return fn()
+}
+
+// read returns the current lease or nil if there is none.
+func (l *FileLock) read() (*lease, error) {
+	data, err := ioutil.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("read lock: %w", err)
+	}
+	current := new(lease)
+	if err := json.Unmarshal(data, current); err != nil {
+		// A partially written lease is treated as expired.
+		return nil, nil
+	}
+	return current, nil
+}
+
+func (l *FileLock) write(current lease) error {
+	data, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(l.path, data)
+}
+
+// writeFileAtomic replaces the file at path so that readers never see it
+// partially written.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return xerrors.Errorf("write %s: %w", path, err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return xerrors.Errorf("write %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return xerrors.Errorf("write %s: %w", path, err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return xerrors.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/clock"
+	"github.com/juju/clock/testclock"
+	"github.com/nikunicke/reaktorw/badapi"
+	"github.com/nikunicke/reaktorw/warehouse/store/memory"
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(FileLockTestSuite))
+
+type FileLockTestSuite struct {
+	dir string
+}
+
+func (s *FileLockTestSuite) SetUpTest(c *check.C) {
+	var err error
+	s.dir, err = ioutil.TempDir("", "filelock")
+	c.Assert(err, check.IsNil)
+}
+
+func (s *FileLockTestSuite) TearDownTest(c *check.C) {
+	_ = os.RemoveAll(s.dir)
+}
+
+func (s *FileLockTestSuite) TestOnlyOneReplicaTakesExpiredLease(c *check.C) {
+	path := filepath.Join(s.dir, "leader.lock")
+	for round := 0; round < 20; round++ {
+		// Every replica sees the previous lease as expired.
+		now := time.Now().Add(time.Duration(round) * time.Hour)
+		locks := make([]*FileLock, 8)
+		for i := range locks {
+			locks[i] = NewFileLock(path, fmt.Sprintf("replica-%d-%d", round, i), time.Minute)
+			locks[i].now = func() time.Time { return now }
+		}
+
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			leaders int
+			start   = make(chan struct{})
+		)
+		for _, lock := range locks {
+			wg.Add(1)
+			go func(lock *FileLock) {
+				defer wg.Done()
+				<-start
+				held, err := lock.Acquire(context.TODO())
+				c.Check(err, check.IsNil)
+				if held {
+					mu.Lock()
+					leaders++
+					mu.Unlock()
+				}
+			}(lock)
+		}
+		close(start)
+		wg.Wait()
+		c.Assert(leaders, check.Equals, 1, check.Commentf("round %d", round))
+	}
+}
+
+func (s *FileLockTestSuite) TestReleaseKeepsLeaseOfNewOwner(c *check.C) {
+	path := filepath.Join(s.dir, "leader.lock")
+	now := time.Now()
+	old, current := NewFileLock(path, "old", time.Minute), NewFileLock(path, "current", time.Minute)
+	old.now = func() time.Time { return now }
+	current.now = func() time.Time { return now.Add(2 * time.Minute) }
+
+	held, err := old.Acquire(context.TODO())
+	c.Assert(err, check.IsNil)
+	c.Assert(held, check.Equals, true)
+	held, err = current.Acquire(context.TODO())
+	c.Assert(err, check.IsNil)
+	c.Assert(held, check.Equals, true)
+
+	c.Assert(old.Release(context.TODO()), check.IsNil)
+	lease, err := current.read()
+	c.Assert(err, check.IsNil)
+	c.Assert(lease, check.NotNil)
+	c.Assert(lease.Owner, check.Equals, "current")
+}
+
+var _ = check.Suite(new(ReplicationTestSuite))
+
+type ReplicationTestSuite struct {
+	dir string
+	srv *httptest.Server
+}
+
+func (s *ReplicationTestSuite) SetUpTest(c *check.C) {
+	var err error
+	s.dir, err = ioutil.TempDir("", "replication")
+	c.Assert(err, check.IsNil)
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := `{"code":200,"response":[{"id":"A1","DATAPAYLOAD":"<AVAILABILITY><INSTOCKVALUE>INSTOCK</INSTOCKVALUE></AVAILABILITY>"}]}`
+		if strings.HasPrefix(r.URL.Path, "/products/gloves") {
+			body = `[{"id":"a1","type":"gloves","name":"glove","manufacturer":"okkau"}]`
+		} else if strings.HasPrefix(r.URL.Path, "/products/") {
+			body = "[]"
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, _ = w.Write([]byte(body))
+	}))
+}
+
+func (s *ReplicationTestSuite) TearDownTest(c *check.C) {
+	s.srv.Close()
+	_ = os.RemoveAll(s.dir)
+}
+
+// newReplica returns a service and its warehouse, both on clk, sharing
+// snapshots through the suite's directory.
+func (s *ReplicationTestSuite) newReplica(c *check.C, clk clock.Clock) (*Service, *memory.InMemoryWarehouse) {
+	warehouse := memory.NewInMemoryWarehouse()
+	warehouse.UseClock(clk)
+	svc, err := NewService(Config{
+		WarehouseAPI:   warehouse,
+		BadAPI:         badapi.NewService().URL(s.srv.URL + "/"),
+		Clock:          clk,
+		UpdateInterval: time.Hour,
+		Lock:           NewFileLock(filepath.Join(s.dir, "leader.lock"), "replica", time.Minute),
+		Snapshots:      NewFileSnapshotStore(filepath.Join(s.dir, "snapshot.json.gz")),
+	})
+	c.Assert(err, check.IsNil)
+	return svc, warehouse
+}
+
+func (s *ReplicationTestSuite) TestFollowerAppliesSnapshotTakenUnderTestClock(c *check.C) {
+	// The leader's clock runs ahead of the wall clock.
+	clk := testclock.NewClock(time.Now().Add(24 * time.Hour))
+	leader, _ := s.newReplica(c, clk)
+	follower, followerWarehouse := s.newReplica(c, clk)
+
+	report, err := leader.execute(context.TODO(), leader.newRun("", TriggerManual, UpdateRequest{}), 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Err, check.IsNil)
+
+	follower.follow()
+	c.Assert(follower.Status().Jobs[SnapshotJob], check.NotNil)
+	c.Assert(follower.Status().Jobs[SnapshotJob].Err, check.IsNil)
+	product, err := followerWarehouse.FindProductByAPIID("a1")
+	c.Assert(err, check.IsNil)
+	c.Assert(product.Name, check.Equals, "glove")
+	availability, err := followerWarehouse.FindAvailabilityByAPIID("a1")
+	c.Assert(err, check.IsNil)
+	c.Assert(availability.Status, check.Equals, "INSTOCK")
+
+	// A newer snapshot is applied even though the leader's clock is ahead of
+	// the snapshot file's modification time.
+	clk.Advance(time.Minute)
+	_, err = leader.execute(context.TODO(), leader.newRun("", TriggerManual, UpdateRequest{}), 0)
+	c.Assert(err, check.IsNil)
+	applied := follower.appliedSnapshot
+	follower.follow()
+	c.Assert(follower.appliedSnapshot.After(applied), check.Equals, true)
+}
@@ -0,0 +1,12 @@
+package updater
+
+import (
+	"os"
+
+	"golang.org/x/xerrors"
+)
+
+var errFileLockUnsupported = xerrors.New("file locks are not supported on windows")
+
+func lockFile(*os.File) error   { return errFileLockUnsupported }
+func unlockFile(*os.File) error { return nil }
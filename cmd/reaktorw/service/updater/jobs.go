@@ -0,0 +1,128 @@
+package updater
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// ProductsJob is the name of the product refresh job. The availability
+// refresh jobs are named AvailabilitiesJobPrefix followed by the manufacturer.
+const (
+	ProductsJob             = "products"
+	AvailabilitiesJobPrefix = "availabilities/"
+)
+
+// JobConfig configures a periodically running update job.
+type JobConfig struct {
+	// Scheduler creates the scheduler of the job. Defaults to running every
+	// Interval.
+	Scheduler func() Scheduler
+	// Interval defaults to Config.UpdateInterval.
+	Interval time.Duration
+	// Timeout bounds a single run of the job. Zero means no timeout.
+	Timeout time.Duration
+}
+
+func (c *JobConfig) validate(defaultInterval time.Duration) error {
+	if c.Scheduler != nil {
+		return nil
+	}
+	if c.Interval <= 0 {
+		c.Interval = defaultInterval
+	}
+	if c.Interval <= 0 {
+		return xerrors.New("invalid update interval")
+	}
+	return nil
+}
+
+func (c JobConfig) newScheduler() Scheduler {
+	if c.Scheduler != nil {
+		return c.Scheduler()
+	}
+	return Every(c.Interval)
+}
+
+// job refreshes part of the warehouse on its own schedule.
+type job struct {
+	name      string
+	request   UpdateRequest
+	scheduler Scheduler
+	timeout   time.Duration
+	// waitReady delays the first run until the warehouse holds products.
+	waitReady bool
+}
+
+// newJobs returns the product refresh job and an availability refresh job per
+// manufacturer.
+func newJobs(conf Config) []*job {
+	jobs := []*job{{
+		name:      ProductsJob,
+		request:   UpdateRequest{Categories: categories},
+		scheduler: conf.Products.newScheduler(),
+		timeout:   conf.Products.Timeout,
+	}}
+	for _, mf := range manufacturers {
+		jobConf, ok := conf.Manufacturers[mf]
+		if !ok {
+			jobConf = conf.Availabilities
+		}
+		jobs = append(jobs, &job{
+			name:      AvailabilitiesJobPrefix + mf,
+			request:   UpdateRequest{Manufacturers: []string{mf}},
+			scheduler: jobConf.newScheduler(),
+			timeout:   jobConf.Timeout,
+			waitReady: true,
+		})
+	}
+	return jobs
+}
+
+// runJob runs j until ctx is cancelled. Scheduled runs are skipped while the
+// schedule is paused.
+func (s *Service) runJob(ctx context.Context, j *job) error {
+	logger := s.conf.Logger.WithField("job", j.name)
+	if j.waitReady {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.readyCh:
+		}
+	}
+	report, err := s.execute(ctx, s.newRun(j.name, TriggerSchedule, j.request), j.timeout)
+	if err != nil {
+		return err
+	}
+	for {
+		delay := j.scheduler.Next(s.conf.Clock.Now(), report)
+		logger.WithField("next_update_in", delay.String()).Info("scheduled next update")
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.conf.Clock.After(delay):
+		}
+		if s.Paused() {
+			logger.Info("skipping scheduled update, schedule paused")
+			continue
+		}
+		if report, err = s.execute(ctx, s.newRun(j.name, TriggerSchedule, j.request), j.timeout); err != nil {
+			return err
+		}
+	}
+}
+
+// runTriggered executes triggered updates until ctx is cancelled.
+func (s *Service) runTriggered(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case run := <-s.triggerCh:
+			if _, err := s.execute(ctx, run, 0); err != nil {
+				return err
+			}
+		}
+	}
+}
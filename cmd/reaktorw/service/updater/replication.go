@@ -0,0 +1,154 @@
+package updater
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nikunicke/reaktorw/warehouse/inventory"
+)
+
+const (
+	// defaultLeaseInterval is used if Config.LeaseInterval is not set.
+	defaultLeaseInterval = 10 * time.Second
+	// SnapshotJob names the reports of applied snapshots in Status.Jobs.
+	SnapshotJob = "snapshot"
+)
+
+// maxUUID bounds the ID range of snapshots.
+var maxUUID = uuid.Must(uuid.Parse("ffffffff-ffff-ffff-ffff-ffffffffffff"))
+
+// elect competes for the lock until ctx is cancelled. While the lock is held
+// the service leads, otherwise it applies the leader's snapshots.
+func (s *Service) elect(ctx context.Context) error {
+	defer func() {
+		if err := s.conf.Lock.Release(context.Background()); err != nil {
+			s.conf.Logger.WithField("err", err.Error()).Warn("failed to release leader lock")
+		}
+	}()
+	for {
+		held, err := s.conf.Lock.Acquire(ctx)
+		if err != nil {
+			s.conf.Logger.WithField("err", err.Error()).Warn("leader election failed")
+		}
+		if held {
+			if err := s.leadWhileHeld(ctx); err != nil {
+				return err
+			}
+		} else {
+			s.setRole(RoleFollower)
+			s.follow()
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.conf.Clock.After(s.conf.LeaseInterval):
+		}
+	}
+}
+
+// leadWhileHeld leads until the lock is lost or ctx is cancelled.
+func (s *Service) leadWhileHeld(ctx context.Context) error {
+	s.setRole(RoleLeader)
+	s.conf.Logger.Info("acquired leadership")
+	leadCtx, cancelFn := context.WithCancel(ctx)
+	defer cancelFn()
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.lead(leadCtx) }()
+
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case <-s.conf.Clock.After(s.conf.LeaseInterval):
+		}
+		held, err := s.conf.Lock.Acquire(ctx)
+		if err != nil {
+			s.conf.Logger.WithField("err", err.Error()).Warn("failed to renew leader lock")
+		}
+		if !held {
+			s.conf.Logger.Warn("lost leadership")
+			cancelFn()
+			return <-errCh
+		}
+	}
+}
+
+func (s *Service) setRole(role string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Role = role
+}
+
+// publishSnapshot shares the contents of the warehouse with followers.
+func (s *Service) publishSnapshot() {
+	// Products and availabilities are stamped with the configured clock,
+	// which the warehouse must share.
+	takenAt := s.conf.Clock.Now()
+	snapshot := &Snapshot{TakenAt: takenAt}
+	productIt, err := s.conf.WarehouseAPI.Products(uuid.Nil, maxUUID, takenAt.Add(time.Second))
+	if err == nil {
+		for productIt.Next() {
+			snapshot.Products = append(snapshot.Products, productIt.Product())
+		}
+		err = productIt.Close()
+	}
+	if err == nil {
+		var availabilityIt inventory.AvailabilityIterator
+		if availabilityIt, err = s.conf.WarehouseAPI.Availabilities(uuid.Nil, maxUUID, takenAt.Add(time.Second)); err == nil {
+			for availabilityIt.Next() {
+				snapshot.Availabilities = append(snapshot.Availabilities, availabilityIt.Availability())
+			}
+			err = availabilityIt.Close()
+		}
+	}
+	if err == nil {
+		err = s.conf.Snapshots.Publish(snapshot)
+	}
+	if err != nil {
+		s.conf.Logger.WithField("err", err.Error()).Error("failed to publish snapshot")
+	}
+}
+
+// follow applies the latest snapshot of the leader, if it has not been
+// applied yet.
+func (s *Service) follow() {
+	snapshot, err := s.conf.Snapshots.Latest(s.appliedSnapshot)
+	if err != nil {
+		s.conf.Logger.WithField("err", err.Error()).Warn("failed to load snapshot")
+		return
+	}
+	if snapshot == nil {
+		return
+	}
+	startAt := s.conf.Clock.Now()
+	report := Report{StartedAt: startAt}
+	for _, product := range snapshot.Products {
+		if report.Err = s.conf.WarehouseAPI.UpsertProduct(product); report.Err != nil {
+			break
+		}
+		report.ProcessedProducts++
+	}
+	for _, availability := range snapshot.Availabilities {
+		if report.Err != nil {
+			break
+		}
+		if report.Err = s.conf.WarehouseAPI.UpsertAvailability(availability); report.Err != nil {
+			break
+		}
+		report.ProcessedAvailabilities++
+	}
+	report.TotalUpdateTime = s.conf.Clock.Now().Sub(startAt)
+	report.WarehousePopulateTime = report.TotalUpdateTime
+	report.Sources = []SourceReport{{
+		Kind:     SourceKindSnapshot,
+		Name:     snapshot.TakenAt.Format(time.RFC3339),
+		Records:  len(snapshot.Products) + len(snapshot.Availabilities),
+		Duration: report.TotalUpdateTime,
+		Err:      report.Err,
+	}}
+	if report.Err == nil {
+		s.appliedSnapshot = snapshot.TakenAt
+	}
+	s.record(&Run{Job: SnapshotJob}, report)
+}
@@ -0,0 +1,196 @@
+package updater
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"github.com/nikunicke/reaktorw/pipeline"
+	"github.com/nikunicke/reaktorw/warehouse/inventory"
+)
+
+// Report summarizes a warehouse update. Err is set if the update was
+// interrupted. Products and availabilities are loaded and stored
+// concurrently, so the load and populate times are measured from StartedAt
+// and overlap.
+type Report struct {
+	StartedAt               time.Time
+	LoadProductsTime        time.Duration
+	LoadAvailabilitiesTime  time.Duration
+	WarehousePopulateTime   time.Duration
+	TotalUpdateTime         time.Duration
+	ProcessedProducts       int
+	ProcessedAvailabilities int
+	// QuarantinedAvailabilities counts the availabilities of unknown products
+	// quarantined by the update, ExpiredAvailabilities those dropped from
+	// quarantine because they outlived the quarantine TTL.
+	QuarantinedAvailabilities int
+	ExpiredAvailabilities     int
+	Quarantine                inventory.QuarantineStats
+	// InFlightRecords counts the records loaded but left unprocessed when
+	// the update was interrupted.
+	InFlightRecords int
+	// Stages holds the statistics of each updater pipeline's stages, keyed
+	// by pipeline name.
+	Stages map[string][]pipeline.StageStats
+
+	Sources []SourceReport
+	Err     error
+}
+
+// SourceReport describes the outcome of loading data from a single badapi
+// endpoint, i.e. a product category or a manufacturer's availabilities.
+type SourceReport struct {
+	Kind        string
+	Name        string
+	Records     int
+	Duration    time.Duration
+	ContentHash uint64
+	Err         error
+}
+
+const (
+	SourceKindProducts       = "products"
+	SourceKindAvailabilities = "availabilities"
+	SourceKindSnapshot       = "snapshot"
+)
+
+// ContentHash combines the content hashes of all sources. Zero is returned if
+// any of the sources failed, as the content is then only partially known.
+func (r Report) ContentHash() uint64 {
+	if r.Err != nil || len(r.Sources) == 0 {
+		return 0
+	}
+	hash := fnv.New64a()
+	for _, source := range r.Sources {
+		if source.Err != nil {
+			return 0
+		}
+		_ = binary.Write(hash, binary.LittleEndian, source.ContentHash)
+	}
+	return hash.Sum64()
+}
+
+type reportJSON struct {
+	StartedAt               time.Time                 `json:"started_at"`
+	LoadProductsTime        string                    `json:"load_products_time"`
+	LoadAvailabilitiesTime  string                    `json:"load_availabilities_time"`
+	WarehousePopulateTime   string                    `json:"warehouse_populate_time"`
+	TotalUpdateTime         string                    `json:"total_update_time"`
+	ProcessedProducts       int                       `json:"processed_products"`
+	ProcessedAvailabilities int                       `json:"processed_availabilities"`
+	Quarantined             int                       `json:"quarantined_availabilities"`
+	Expired                 int                       `json:"expired_availabilities"`
+	Quarantine              inventory.QuarantineStats `json:"quarantine"`
+	InFlight                int                       `json:"in_flight_records"`
+	ContentHash             string                    `json:"content_hash,omitempty"`
+	Stages                  map[string][]stageJSON    `json:"stages,omitempty"`
+	Sources                 []SourceReport            `json:"sources"`
+	Error                   string                    `json:"error,omitempty"`
+}
+
+// MarshalJSON encodes durations as strings and the error as its message.
+func (r Report) MarshalJSON() ([]byte, error) {
+	return json.Marshal(reportJSON{
+		StartedAt:               r.StartedAt,
+		LoadProductsTime:        r.LoadProductsTime.String(),
+		LoadAvailabilitiesTime:  r.LoadAvailabilitiesTime.String(),
+		WarehousePopulateTime:   r.WarehousePopulateTime.String(),
+		TotalUpdateTime:         r.TotalUpdateTime.String(),
+		ProcessedProducts:       r.ProcessedProducts,
+		ProcessedAvailabilities: r.ProcessedAvailabilities,
+		Quarantined:             r.QuarantinedAvailabilities,
+		Expired:                 r.ExpiredAvailabilities,
+		Quarantine:              r.Quarantine,
+		InFlight:                r.InFlightRecords,
+		ContentHash:             hashString(r.ContentHash()),
+		Stages:                  stagesJSON(r.Stages),
+		Sources:                 r.Sources,
+		Error:                   errorString(r.Err),
+	})
+}
+
+type sourceReportJSON struct {
+	Kind        string `json:"kind"`
+	Name        string `json:"name"`
+	OK          bool   `json:"ok"`
+	Records     int    `json:"records"`
+	Duration    string `json:"duration"`
+	ContentHash string `json:"content_hash,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// MarshalJSON encodes the duration as a string and the error as its message.
+func (r SourceReport) MarshalJSON() ([]byte, error) {
+	return json.Marshal(sourceReportJSON{
+		Kind:        r.Kind,
+		Name:        r.Name,
+		OK:          r.Err == nil,
+		Records:     r.Records,
+		Duration:    r.Duration.String(),
+		ContentHash: hashString(r.ContentHash),
+		Error:       errorString(r.Err),
+	})
+}
+
+type stageJSON struct {
+	Stage    int    `json:"stage"`
+	In       int    `json:"in"`
+	Out      int    `json:"out"`
+	Dropped  int    `json:"dropped"`
+	Errors   int    `json:"errors"`
+	Duration string `json:"duration"`
+	P50      string `json:"p50"`
+	P90      string `json:"p90"`
+	P99      string `json:"p99"`
+}
+
+func stagesJSON(stages map[string][]pipeline.StageStats) map[string][]stageJSON {
+	if len(stages) == 0 {
+		return nil
+	}
+	out := make(map[string][]stageJSON, len(stages))
+	for name, stats := range stages {
+		for _, stage := range stats {
+			out[name] = append(out[name], stageJSON{
+				Stage:    stage.StageIndex,
+				In:       stage.In,
+				Out:      stage.Out,
+				Dropped:  stage.Dropped,
+				Errors:   stage.Errors,
+				Duration: stage.Duration.String(),
+				P50:      stage.P50.String(),
+				P90:      stage.P90.String(),
+				P99:      stage.P99.String(),
+			})
+		}
+	}
+	return out
+}
+
+func hashString(hash uint64) string {
+	if hash == 0 {
+		return ""
+	}
+	return strconv.FormatUint(hash, 16)
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// Status describes the state of the updater service. Ready is set once the
+// products of every category have been loaded into the warehouse. Jobs holds
+// the last report of each periodic job. Role tells whether the service leads
+// the updates or follows the leader's snapshots.
+type Status struct {
+	Ready      bool               `json:"ready"`
+	Role       string             `json:"role"`
+	LastUpdate *Report            `json:"last_update"`
+	Jobs       map[string]*Report `json:"jobs"`
+}
@@ -0,0 +1,172 @@
+package updater
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+)
+
+var (
+	ErrUnknownCategory     = xerrors.New("warehouse-updater: unknown category")
+	ErrUnknownManufacturer = xerrors.New("warehouse-updater: unknown manufacturer")
+	ErrTriggerQueueFull    = xerrors.New("warehouse-updater: too many pending updates")
+)
+
+const (
+	// maxPendingTriggers bounds the number of triggered updates waiting to run.
+	maxPendingTriggers = 8
+	// runHistorySize is the number of runs kept for inspection.
+	runHistorySize = 20
+)
+
+// categories and manufacturers updated from badapi.
+var (
+	categories    = []string{"gloves", "facemasks", "beanies"}
+	manufacturers = []string{"okkau", "juuran", "niksleh", "abiplos", "hennex", "umpante", "laion", "ippal"}
+)
+
+// UpdateRequest scopes a warehouse update. An empty request updates every
+// category and manufacturer, otherwise only the listed sources are loaded.
+type UpdateRequest struct {
+	Categories    []string `json:"categories,omitempty"`
+	Manufacturers []string `json:"manufacturers,omitempty"`
+}
+
+func (r UpdateRequest) empty() bool {
+	return len(r.Categories) == 0 && len(r.Manufacturers) == 0
+}
+
+// sources returns the categories and manufacturers to load for the request.
+func (r UpdateRequest) sources() ([]string, []string) {
+	if r.empty() {
+		return categories, manufacturers
+	}
+	return r.Categories, r.Manufacturers
+}
+
+func (r UpdateRequest) validate() error {
+	for _, ctg := range r.Categories {
+		if !contains(categories, ctg) {
+			return xerrors.Errorf("category %q: %w", ctg, ErrUnknownCategory)
+		}
+	}
+	for _, mf := range r.Manufacturers {
+		if !contains(manufacturers, mf) {
+			return xerrors.Errorf("manufacturer %q: %w", mf, ErrUnknownManufacturer)
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Run triggers
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// Run states
+const (
+	RunQueued    = "queued"
+	RunRunning   = "running"
+	RunCompleted = "completed"
+	RunFailed    = "failed"
+)
+
+// Run is a single execution of a warehouse update.
+type Run struct {
+	ID       string        `json:"id"`
+	Job      string        `json:"job,omitempty"`
+	Trigger  string        `json:"trigger"`
+	Request  UpdateRequest `json:"request"`
+	State    string        `json:"state"`
+	QueuedAt time.Time     `json:"queued_at"`
+	Report   *Report       `json:"report"`
+}
+
+// Trigger queues an immediate warehouse update. The returned run can be
+// looked up from Runs once it has been picked up by the update loop.
+func (s *Service) Trigger(req UpdateRequest) (Run, error) {
+	if err := req.validate(); err != nil {
+		return Run{}, err
+	}
+	run := s.newRun("", TriggerManual, req)
+	select {
+	case s.triggerCh <- run:
+	default:
+		s.setRunState(run, RunFailed, nil)
+		return Run{}, ErrTriggerQueueFull
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *run, nil
+}
+
+// Runs returns the most recent runs, newest first.
+func (s *Service) Runs() []Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runs := make([]Run, len(s.runs))
+	for i, run := range s.runs {
+		runs[len(s.runs)-1-i] = *run
+	}
+	return runs
+}
+
+// Pause stops the periodic schedule. Triggered updates still run.
+func (s *Service) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = true
+}
+
+// Resume restarts a paused periodic schedule.
+func (s *Service) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = false
+}
+
+// Paused reports whether the periodic schedule is paused.
+func (s *Service) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+func (s *Service) newRun(job, trigger string, req UpdateRequest) *Run {
+	run := &Run{
+		ID:       uuid.New().String(),
+		Job:      job,
+		Trigger:  trigger,
+		Request:  req,
+		State:    RunQueued,
+		QueuedAt: s.conf.Clock.Now(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs = append(s.runs, run)
+	if len(s.runs) > runHistorySize {
+		s.runs = s.runs[len(s.runs)-runHistorySize:]
+	}
+	return run
+}
+
+func (s *Service) setRunState(run *Run, state string, report *Report) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run.State = state
+	if report != nil {
+		run.Report = report
+	}
+}
@@ -0,0 +1,154 @@
+package updater
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/clock"
+	"github.com/robfig/cron/v3"
+	"golang.org/x/xerrors"
+)
+
+// Scheduler decides when the next periodic warehouse update runs. Next is
+// called from the update loop after every scheduled update, with the time the
+// update finished and its report, and returns the delay until the next one.
+// Schedulers are not safe for concurrent use.
+type Scheduler interface {
+	Next(now time.Time, last Report) time.Duration
+}
+
+// SchedulerFunc is an adapter to allow the use of ordinary functions as
+// schedulers.
+type SchedulerFunc func(now time.Time, last Report) time.Duration
+
+func (f SchedulerFunc) Next(now time.Time, last Report) time.Duration {
+	return f(now, last)
+}
+
+// Every returns a Scheduler running updates at a fixed interval.
+func Every(interval time.Duration) Scheduler {
+	return SchedulerFunc(func(time.Time, Report) time.Duration { return interval })
+}
+
+// Cron returns a Scheduler running updates according to a standard five field
+// cron expression, e.g. "*/5 * * * *", or a descriptor such as "@hourly".
+func Cron(expr string) (Scheduler, error) {
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	return SchedulerFunc(func(now time.Time, _ Report) time.Duration {
+		return schedule.Next(now).Sub(now)
+	}), nil
+}
+
+type jitter struct {
+	s         Scheduler
+	maxJitter time.Duration
+	rnd       func() float64
+}
+
+// WithJitter delays every update scheduled by s by a random duration in
+// [0, maxJitter).
+func WithJitter(s Scheduler, maxJitter time.Duration) Scheduler {
+	return &jitter{s: s, maxJitter: maxJitter, rnd: rand.Float64}
+}
+
+func (j *jitter) Next(now time.Time, last Report) time.Duration {
+	return j.s.Next(now, last) + time.Duration(j.rnd()*float64(j.maxJitter))
+}
+
+type backoff struct {
+	s        Scheduler
+	base     time.Duration
+	max      time.Duration
+	failures int
+}
+
+// WithBackoff retries failed updates after base, doubling the delay after
+// every consecutive failure up to max. Once an update succeeds, scheduling is
+// handed back to s.
+func WithBackoff(s Scheduler, base, max time.Duration) Scheduler {
+	return &backoff{s: s, base: base, max: max}
+}
+
+func (b *backoff) Next(now time.Time, last Report) time.Duration {
+	if last.Err == nil {
+		b.failures = 0
+		return b.s.Next(now, last)
+	}
+	b.failures++
+	delay := b.base
+	for i := 1; i < b.failures && delay < b.max; i++ {
+		delay *= 2
+	}
+	if delay > b.max {
+		delay = b.max
+	}
+	return delay
+}
+
+type adaptive struct {
+	min      time.Duration
+	max      time.Duration
+	factor   float64
+	interval time.Duration
+	lastHash uint64
+}
+
+// Adaptive returns a Scheduler that polls every min right after the upstream
+// data has been detected as regenerated and backs off by factor, up to max,
+// while the content of the updates stays unchanged. Updates with an unknown
+// content hash, e.g. because a source failed, keep the current interval.
+func Adaptive(min, max time.Duration, factor float64) Scheduler {
+	return &adaptive{min: min, max: max, factor: factor, interval: min}
+}
+
+func (a *adaptive) Next(now time.Time, last Report) time.Duration {
+	hash := last.ContentHash()
+	switch {
+	case hash == 0:
+	case hash != a.lastHash:
+		a.lastHash = hash
+		a.interval = a.min
+	default:
+		a.interval = time.Duration(float64(a.interval) * a.factor)
+		if a.interval > a.max {
+			a.interval = a.max
+		}
+	}
+	return a.interval
+}
+
+// timeoutContext reports context.DeadlineExceeded once it has timed out.
+type timeoutContext struct {
+	context.Context
+	timedOut int32
+}
+
+func (c *timeoutContext) Err() error {
+	if atomic.LoadInt32(&c.timedOut) == 1 {
+		return context.DeadlineExceeded
+	}
+	return c.Context.Err()
+}
+
+// withClockTimeout is context.WithTimeout measuring the timeout on clk, so
+// that timeouts follow the clock the schedulers run on.
+func withClockTimeout(ctx context.Context, clk clock.Clock, timeout time.Duration) (context.Context, context.CancelFunc) {
+	cancelCtx, cancelFn := context.WithCancel(ctx)
+	timeoutCtx := &timeoutContext{Context: cancelCtx}
+	timer := clk.NewTimer(timeout)
+	go func() {
+		select {
+		case <-timer.Chan():
+			atomic.StoreInt32(&timeoutCtx.timedOut, 1)
+			cancelFn()
+		case <-cancelCtx.Done():
+			timer.Stop()
+		}
+	}()
+	return timeoutCtx, cancelFn
+}
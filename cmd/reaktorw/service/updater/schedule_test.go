@@ -0,0 +1,122 @@
+package updater
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/clock/testclock"
+	"github.com/nikunicke/reaktorw/badapi"
+	"github.com/nikunicke/reaktorw/warehouse/store/memory"
+	"golang.org/x/xerrors"
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(SchedulerTestSuite))
+
+type SchedulerTestSuite struct {
+	clock *testclock.Clock
+}
+
+func (s *SchedulerTestSuite) SetUpTest(c *check.C) {
+	s.clock = testclock.NewClock(time.Date(2021, 2, 27, 10, 2, 0, 0, time.UTC))
+}
+
+// reportWithHash returns a successful report whose content hashes to a value
+// derived from content.
+func reportWithHash(content uint64) Report {
+	return Report{Sources: []SourceReport{{ContentHash: content}}}
+}
+
+func (s *SchedulerTestSuite) TestEvery(c *check.C) {
+	sched := Every(time.Minute)
+	c.Assert(sched.Next(s.clock.Now(), Report{}), check.Equals, time.Minute)
+	s.clock.Advance(42 * time.Second)
+	c.Assert(sched.Next(s.clock.Now(), Report{Err: xerrors.New("failed")}), check.Equals, time.Minute)
+}
+
+func (s *SchedulerTestSuite) TestCron(c *check.C) {
+	sched, err := Cron("*/5 * * * *")
+	c.Assert(err, check.IsNil)
+	c.Assert(sched.Next(s.clock.Now(), Report{}), check.Equals, 3*time.Minute)
+	s.clock.Advance(3 * time.Minute)
+	c.Assert(sched.Next(s.clock.Now(), Report{}), check.Equals, 5*time.Minute)
+
+	_, err = Cron("every now and then")
+	c.Assert(err, check.NotNil)
+}
+
+func (s *SchedulerTestSuite) TestBackoff(c *check.C) {
+	sched := WithBackoff(Every(time.Hour), time.Second, 5*time.Second)
+	failed := Report{Err: xerrors.New("failed")}
+
+	var delays []time.Duration
+	for i := 0; i < 5; i++ {
+		delays = append(delays, sched.Next(s.clock.Now(), failed))
+	}
+	c.Assert(delays, check.DeepEquals, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second})
+	c.Assert(sched.Next(s.clock.Now(), Report{}), check.Equals, time.Hour)
+	c.Assert(sched.Next(s.clock.Now(), failed), check.Equals, time.Second)
+}
+
+func (s *SchedulerTestSuite) TestAdaptive(c *check.C) {
+	sched := Adaptive(time.Minute, 4*time.Minute, 2)
+
+	c.Assert(sched.Next(s.clock.Now(), reportWithHash(1)), check.Equals, time.Minute)
+	c.Assert(sched.Next(s.clock.Now(), reportWithHash(1)), check.Equals, 2*time.Minute)
+	c.Assert(sched.Next(s.clock.Now(), reportWithHash(1)), check.Equals, 4*time.Minute)
+	c.Assert(sched.Next(s.clock.Now(), reportWithHash(1)), check.Equals, 4*time.Minute)
+	// Unknown content keeps the interval, new content resets it.
+	c.Assert(sched.Next(s.clock.Now(), Report{Err: xerrors.New("failed")}), check.Equals, 4*time.Minute)
+	c.Assert(sched.Next(s.clock.Now(), reportWithHash(2)), check.Equals, time.Minute)
+}
+
+func (s *SchedulerTestSuite) TestWithJitter(c *check.C) {
+	sched := WithJitter(Every(time.Minute), 10*time.Second).(*jitter)
+	sched.rnd = func() float64 { return .5 }
+	c.Assert(sched.Next(s.clock.Now(), Report{}), check.Equals, time.Minute+5*time.Second)
+}
+
+func (s *SchedulerTestSuite) TestClockTimeout(c *check.C) {
+	ctx, cancelFn := withClockTimeout(context.Background(), s.clock, time.Minute)
+	defer cancelFn()
+
+	c.Assert(s.clock.WaitAdvance(59*time.Second, time.Second, 1), check.IsNil)
+	c.Assert(ctx.Err(), check.IsNil)
+	s.clock.Advance(time.Second)
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		c.Fatal("context not cancelled after timeout")
+	}
+	c.Assert(ctx.Err(), check.Equals, context.DeadlineExceeded)
+}
+
+func (s *SchedulerTestSuite) TestJobRunsOnSchedule(c *check.C) {
+	srv := newEmptyBadAPI()
+	defer srv.Close()
+
+	svc, err := NewService(Config{
+		WarehouseAPI:   memory.NewInMemoryWarehouse(),
+		BadAPI:         badapi.NewService().URL(srv.URL + "/"),
+		Clock:          s.clock,
+		UpdateInterval: time.Hour,
+		Products:       JobConfig{Scheduler: func() Scheduler { return Every(10 * time.Minute) }},
+	})
+	c.Assert(err, check.IsNil)
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- svc.runJob(ctx, newJobs(svc.conf)[0]) }()
+
+	// The first run is immediate, the next ones wait for the clock.
+	c.Assert(s.clock.WaitAdvance(10*time.Minute, time.Second, 1), check.IsNil)
+	c.Assert(s.clock.WaitAdvance(10*time.Minute, time.Second, 1), check.IsNil)
+	// Wait for the third run to finish before pausing the schedule.
+	c.Assert(s.clock.WaitAdvance(time.Nanosecond, time.Second, 1), check.IsNil)
+	svc.Pause()
+	c.Assert(s.clock.WaitAdvance(10*time.Minute, time.Second, 1), check.IsNil)
+	c.Assert(s.clock.WaitAdvance(time.Nanosecond, time.Second, 1), check.IsNil)
+	cancelFn()
+	c.Assert(<-done, check.IsNil)
+	c.Assert(svc.Runs(), check.HasLen, 3)
+}
@@ -0,0 +1,99 @@
+package updater
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nikunicke/reaktorw/warehouse/inventory"
+	"golang.org/x/xerrors"
+)
+
+// Snapshot holds the contents of the leader's warehouse.
+type Snapshot struct {
+	TakenAt        time.Time                 `json:"taken_at"`
+	Products       []*inventory.Product      `json:"products"`
+	Availabilities []*inventory.Availability `json:"availabilities"`
+}
+
+// SnapshotStore shares snapshots of the leader's warehouse with followers.
+type SnapshotStore interface {
+	Publish(snapshot *Snapshot) error
+	// Latest returns the most recent snapshot if it was taken after after,
+	// nil otherwise.
+	Latest(after time.Time) (*Snapshot, error)
+}
+
+// FileSnapshotStore is a SnapshotStore keeping the latest snapshot in a
+// gzipped JSON file, for replicas sharing a file system.
+type FileSnapshotStore struct {
+	path string
+
+	mu sync.Mutex
+	// modTime is the modification time of the file when Latest last found
+	// it held no newer snapshot.
+	modTime time.Time
+}
+
+// NewFileSnapshotStore returns a snapshot store writing to path.
+func NewFileSnapshotStore(path string) *FileSnapshotStore {
+	return &FileSnapshotStore{path: path}
+}
+
+// Publish implements SnapshotStore.
+func (s *FileSnapshotStore) Publish(snapshot *Snapshot) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(snapshot); err != nil {
+		return xerrors.Errorf("encode snapshot: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return xerrors.Errorf("encode snapshot: %w", err)
+	}
+	return writeFileAtomic(s.path, buf.Bytes())
+}
+
+// Latest implements SnapshotStore. The file is only decoded if it has been
+// modified since Latest last found no newer snapshot in it. Snapshots are stamped by the leader's
+// clock, which need not be the file system's, so after is compared with the
+// time the snapshot was taken rather than the modification time.
+func (s *FileSnapshotStore) Latest(after time.Time) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("read snapshot: %w", err)
+	}
+	if info.ModTime().Equal(s.modTime) {
+		return nil, nil
+	}
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, xerrors.Errorf("read snapshot: %w", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, xerrors.Errorf("read snapshot: %w", err)
+	}
+	data, err := ioutil.ReadAll(gz)
+	if err != nil {
+		return nil, xerrors.Errorf("read snapshot: %w", err)
+	}
+	snapshot := new(Snapshot)
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, xerrors.Errorf("decode snapshot: %w", err)
+	}
+	if !snapshot.TakenAt.After(after) {
+		s.modTime = info.ModTime()
+		return nil, nil
+	}
+	return snapshot, nil
+}
@@ -2,13 +2,17 @@ package updater
 
 import (
 	"context"
+	"fmt"
+	"hash/fnv"
 	"io/ioutil"
 	"runtime"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/juju/clock"
 	"github.com/nikunicke/reaktorw/badapi"
+	"github.com/nikunicke/reaktorw/pipeline"
 	updater_pipeline "github.com/nikunicke/reaktorw/updater"
 	"github.com/nikunicke/reaktorw/warehouse/inventory"
 	"github.com/sirupsen/logrus"
@@ -18,13 +22,63 @@ import (
 type WarehouseAPI interface {
 	UpsertProduct(*inventory.Product) error
 	UpsertAvailability(*inventory.Availability) error
+	QuarantineAvailability(*inventory.Availability) error
+	ExpireQuarantine(quarantinedBefore time.Time) (int, error)
+	QuarantineStats() inventory.QuarantineStats
+	Products(fromID, toID uuid.UUID, retrievedBefore time.Time) (inventory.ProductIterator, error)
+	Availabilities(fromID, toID uuid.UUID, updatedBefore time.Time) (inventory.AvailabilityIterator, error)
+}
+
+const (
+	// defaultQuarantineTTL is used if Config.QuarantineTTL is not set.
+	defaultQuarantineTTL = time.Hour
+	// stageQueueSize buffers payloads between pipeline stages, so that
+	// decoding availabilities does not wait for every warehouse write.
+	stageQueueSize = 256
+	// drainTimeout is how long an interrupted update keeps storing the
+	// records it has already loaded, so that the warehouse is left in a
+	// known state.
+	drainTimeout = 5 * time.Second
+)
+
+// MetricsAPI collects metrics from badapi requests and the updater pipelines.
+type MetricsAPI interface {
+	badapi.RequestObserver
+	PipelineObserver(pipelineName string) pipeline.Observer
+	ObserveQueue(pipelineName string, stageIndex, depth int)
 }
 
 type Config struct {
 	WarehouseAPI WarehouseAPI
+	Metrics      MetricsAPI
+	// BadAPI is the client used to load data. Defaults to badapi.NewService().
+	BadAPI *badapi.Service
 
-	Clock          clock.Clock
+	// Clock defaults to the wall clock. It stamps the products loaded, and
+	// quarantined availabilities are expired and snapshots taken by its time,
+	// so it must be the clock the warehouse stamps availabilities with.
+	Clock clock.Clock
+	// UpdateInterval is the default interval of jobs that do not configure a
+	// scheduler or an interval of their own.
 	UpdateInterval time.Duration
+	// Products configures the product refresh job.
+	Products JobConfig
+	// Availabilities configures the availability refresh job of each
+	// manufacturer, unless overridden in Manufacturers.
+	Availabilities JobConfig
+	Manufacturers  map[string]JobConfig
+	// QuarantineTTL is how long availabilities of unknown products are kept
+	// waiting for their products. Defaults to an hour.
+	QuarantineTTL time.Duration
+
+	// Lock enables leader election between replicas. Only the replica holding
+	// the lock loads data from badapi, the others apply the snapshots the
+	// leader publishes to Snapshots. Without a lock the service always leads.
+	Lock      Lock
+	Snapshots SnapshotStore
+	// LeaseInterval is how often the leader renews the lock and followers
+	// poll for snapshots. Defaults to 10 seconds.
+	LeaseInterval time.Duration
 
 	Logger *logrus.Entry
 }
@@ -38,9 +92,33 @@ func (c *Config) validate() error {
 	if c.Clock == nil {
 		c.Clock = clock.WallClock
 	}
-	if c.UpdateInterval <= 0 {
-		// err = multierror.Append(err, xerrors.New("invalid update interval"))
-		err = xerrors.New("invalid update interval")
+	if errJob := c.Products.validate(c.UpdateInterval); errJob != nil {
+		// err = multierror.Append(err, errJob)
+		err = xerrors.Errorf("products job: %w", errJob)
+	}
+	if errJob := c.Availabilities.validate(c.UpdateInterval); errJob != nil {
+		// err = multierror.Append(err, errJob)
+		err = xerrors.Errorf("availabilities job: %w", errJob)
+	}
+	for mf, jobConf := range c.Manufacturers {
+		if !contains(manufacturers, mf) {
+			err = xerrors.Errorf("manufacturer %q: %w", mf, ErrUnknownManufacturer)
+			continue
+		}
+		if errJob := jobConf.validate(c.Availabilities.Interval); errJob != nil {
+			err = xerrors.Errorf("availabilities job of %q: %w", mf, errJob)
+			continue
+		}
+		c.Manufacturers[mf] = jobConf
+	}
+	if c.Lock != nil && c.Snapshots == nil {
+		err = xerrors.New("snapshot store required for leader election")
+	}
+	if c.LeaseInterval <= 0 {
+		c.LeaseInterval = defaultLeaseInterval
+	}
+	if c.QuarantineTTL <= 0 {
+		c.QuarantineTTL = defaultQuarantineTTL
 	}
 	if c.Logger == nil {
 		c.Logger = logrus.NewEntry(&logrus.Logger{Out: ioutil.Discard})
@@ -52,205 +130,392 @@ type Service struct {
 	conf    Config
 	api     *badapi.Service
 	updater *updater_pipeline.Updater
+
+	jobs      []*job
+	triggerCh chan *Run
+	readyCh   chan struct{}
+	// appliedSnapshot is the time the last snapshot applied as a follower was
+	// taken at.
+	appliedSnapshot time.Time
+
+	mu          sync.Mutex
+	subscribers []func(Report)
+	status      Status
+	// synced holds the categories loaded by a successful update so far.
+	synced      map[string]bool
+	runs        []*Run
+	deadLetters []DeadLetter
+	paused      bool
 }
 
 func NewService(conf Config) (*Service, error) {
 	if err := conf.validate(); err != nil {
 		return nil, xerrors.New("warehouse-updater service: config validation failed")
 	}
-	return &Service{
-		api: badapi.NewService(),
-		updater: updater_pipeline.NewUpdater(updater_pipeline.Config{
-			Warehouse: conf.WarehouseAPI,
-			Workers:   runtime.NumCPU(),
-		}),
-		conf: conf,
-	}, nil
+	api := conf.BadAPI
+	if api == nil {
+		api = badapi.NewService()
+	}
+	updaterConf := updater_pipeline.Config{
+		Warehouse:    conf.WarehouseAPI,
+		Clock:        conf.Clock,
+		Workers:      runtime.NumCPU(),
+		QueueSize:    stageQueueSize,
+		DrainTimeout: drainTimeout,
+	}
+	updaterConf.Observe = func(pipelineName string) pipeline.Observer {
+		return pipeline.NewLogObserver(conf.Logger, pipelineName)
+	}
+	if conf.Metrics != nil {
+		api.Observer(conf.Metrics)
+		updaterConf.Observe = func(pipelineName string) pipeline.Observer {
+			return pipeline.MultiObserver(
+				pipeline.NewLogObserver(conf.Logger, pipelineName),
+				conf.Metrics.PipelineObserver(pipelineName),
+			)
+		}
+		updaterConf.ObserveQueue = conf.Metrics.ObserveQueue
+	}
+	service := &Service{
+		api:       api,
+		conf:      conf,
+		jobs:      newJobs(conf),
+		triggerCh: make(chan *Run, maxPendingTriggers),
+		readyCh:   make(chan struct{}),
+		synced:    make(map[string]bool, len(categories)),
+	}
+	updaterConf.DeadLetter = service.recordDeadLetter
+	service.updater = updater_pipeline.NewUpdater(updaterConf)
+	return service, nil
 }
 
 // Name returns the name of the service as a string
 func (s *Service) Name() string { return "warehouse-updater" }
 
-// Run executes a service, implementing service.Service Run()
-func (s *Service) Run(ctx context.Context) error {
-	s.conf.Logger.WithField("update interval", s.conf.UpdateInterval.String()).Info("starting service")
-	defer s.conf.Logger.Info("stopped service")
-	if err := s.updateWarehouse(ctx); err != nil {
-		return err
-	}
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		case <-s.conf.Clock.After(s.conf.UpdateInterval):
-			if err := s.updateWarehouse(ctx); err != nil {
-				return err
-			}
-		}
-	}
+// Subscribe registers fn to be called with the report of every warehouse
+// update, including failed ones, which may have written part of their data
+// to the warehouse. Subscribers are called synchronously from the update loop,
+// and the service only becomes ready once they have returned, so that views
+// of the warehouse they build are in place when it is.
+func (s *Service) Subscribe(fn func(Report)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers = append(s.subscribers, fn)
 }
 
-func (s *Service) updateWarehouse(ctx context.Context) error {
-	s.conf.Logger.Info("starting warehouse update ...")
-	startAt := s.conf.Clock.Now()
-	tick := startAt
+// Status returns the current state of the service.
+func (s *Service) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	prodIt, err := s.loadProducts("gloves", "facemasks", "beanies")
-	if err != nil {
-		s.conf.Logger.WithField("info", "failed to load propducts").Error("update interrupted")
-		return nil
+	status := s.status
+	status.Jobs = make(map[string]*Report, len(s.status.Jobs))
+	for name, report := range s.status.Jobs {
+		status.Jobs[name] = report
 	}
+	return status
+}
 
-	loadProductsTime := s.conf.Clock.Now().Sub(tick)
-	tick = s.conf.Clock.Now()
-
-	availIt, err := s.loadAvailabilities("okkau", "juuran", "niksleh", "abiplos", "hennex", "umpante", "laion", "ippal")
-	if err != nil {
-		s.conf.Logger.WithField("info", "failed to load availabilities").Error("update interrupted")
-		return nil
+// record stores the report of run and notifies subscribers. The service
+// becomes ready once the products of every category have been loaded by
+// updates without errors and the subscribers have seen them.
+func (s *Service) record(run *Run, report Report) {
+	s.mu.Lock()
+	s.status.LastUpdate = &report
+	if run.Job != "" {
+		if s.status.Jobs == nil {
+			s.status.Jobs = make(map[string]*Report)
+		}
+		s.status.Jobs[run.Job] = &report
+	}
+	subscribers := append([]func(Report){}, s.subscribers...)
+	s.mu.Unlock()
+	for _, fn := range subscribers {
+		fn(report)
+	}
+	if report.Err != nil {
+		return
 	}
 
-	loadAvailabilitiesTime := s.conf.Clock.Now().Sub(tick)
-	tick = s.conf.Clock.Now()
-	// populate warehouse
-
-	procProducts, procAvailabilities, err := s.updater.Update(ctx, prodIt, availIt)
-	if err != nil {
-		return err
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctgs, _ := run.Request.sources()
+	for _, ctg := range ctgs {
+		s.synced[ctg] = true
+	}
+	if len(s.synced) == len(categories) && !s.status.Ready {
+		s.status.Ready = true
+		close(s.readyCh)
 	}
+}
 
-	warehousePopulateTime := s.conf.Clock.Now().Sub(tick)
-	s.conf.Logger.WithFields(logrus.Fields{
-		"load_products_time":       loadProductsTime.String(),
-		"load_availabilities_time": loadAvailabilitiesTime.String(),
-		"warehouse_populate_time":  warehousePopulateTime.String(),
-		"total_update_time":        s.conf.Clock.Now().Sub(startAt),
-		"processed_products":       procProducts,
-		"processed_availabilities": procAvailabilities,
-	}).Info("completed warehouse update")
-	return nil
+// Run executes a service, implementing service.Service Run()
+func (s *Service) Run(ctx context.Context) error {
+	s.conf.Logger.WithField("jobs", len(s.jobs)).Info("starting service")
+	defer s.conf.Logger.Info("stopped service")
+	if s.conf.Lock == nil {
+		s.setRole(RoleLeader)
+		return s.lead(ctx)
+	}
+	return s.elect(ctx)
 }
 
-func (s *Service) loadProducts(ctgs ...string) (badapi.ProductIterator, error) {
-	products := make([][]*badapi.Product, len(ctgs))
-	errCh := make(chan error, len(ctgs))
-	var wg sync.WaitGroup
+// lead runs the update jobs and triggered updates until ctx is cancelled.
+func (s *Service) lead(ctx context.Context) error {
+	runCtx, cancelFn := context.WithCancel(ctx)
+	defer cancelFn()
 
-	for i, ctg := range ctgs {
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(s.jobs)+1)
+	runFn := func(fn func(context.Context) error) {
 		wg.Add(1)
-		go func(i int, c string) {
+		go func() {
 			defer wg.Done()
-			ctgProducts, err := badapi.Products(s.api).List(c).Do()
-			if err != nil {
+			if err := fn(runCtx); err != nil {
 				errCh <- err
-				return
+				cancelFn()
 			}
-			products[i] = ctgProducts.Products
-		}(i, ctg)
+		}()
+	}
+	for _, j := range s.jobs {
+		j := j
+		runFn(func(ctx context.Context) error { return s.runJob(ctx, j) })
 	}
+	runFn(s.runTriggered)
 	wg.Wait()
+
 	var err error
 	close(errCh)
-	for errIn := range errCh {
-		// err = multierror.Append(err, errIn)
-		err = errIn
+	for jobErr := range errCh {
+		// err = multierror.Append(err, jobErr)
+		err = jobErr
 	}
-	return &ProductIterator{products: products}, err
+	return err
 }
 
-func (s *Service) loadAvailabilities(manufacturers ...string) (badapi.AvailabilityIterator, error) {
-	availabilities := make([][]*badapi.Response, len(manufacturers))
-	errCh := make(chan error, len(manufacturers))
-	var wg sync.WaitGroup
+// execute runs a warehouse update, bounded by timeout if non-zero, and keeps
+// the run's state up to date.
+func (s *Service) execute(ctx context.Context, run *Run, timeout time.Duration) (Report, error) {
+	s.setRunState(run, RunRunning, nil)
+	if timeout > 0 {
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = withClockTimeout(ctx, s.conf.Clock, timeout)
+		defer cancelFn()
+	}
+	report, err := s.updateWarehouse(ctx, run.Request)
+	state := RunCompleted
+	if report.Err != nil {
+		state = RunFailed
+	}
+	s.setRunState(run, state, &report)
+	s.record(run, report)
+	if report.Err == nil && s.conf.Snapshots != nil {
+		s.publishSnapshot()
+	}
+	return report, err
+}
 
-	for i, manufacturer := range manufacturers {
-		wg.Add(1)
-		go func(i int, mf string) {
-			defer wg.Done()
-			mfAvailabilities, err := badapi.Availabilities(s.api).Get(mf).Do()
-			if err != nil {
-				errCh <- err
-				return
-			}
-			availabilities[i] = mfAvailabilities.Response
-		}(i, manufacturer)
+// updateWarehouse loads the requested products and availabilities
+// concurrently, streaming each response into the warehouse as soon as it
+// arrives.
+func (s *Service) updateWarehouse(ctx context.Context, req UpdateRequest) (report Report, err error) {
+	ctgs, mfs := req.sources()
+	logger := s.conf.Logger.WithFields(logrus.Fields{
+		"categories":    ctgs,
+		"manufacturers": mfs,
+	})
+	logger.Info("starting warehouse update ...")
+	startAt := s.conf.Clock.Now()
+	report = Report{StartedAt: startAt}
+	defer func() { report.TotalUpdateTime = s.conf.Clock.Now().Sub(startAt) }()
+
+	loadCtx, cancelFn := context.WithCancel(ctx)
+	defer cancelFn()
+	productSources := make([]*productSource, len(ctgs))
+	productIts := make([]badapi.ProductIterator, len(ctgs))
+	for i, ctg := range ctgs {
+		productSources[i] = s.loadProducts(loadCtx, ctg)
+		productIts[i] = productSources[i]
 	}
-	wg.Wait()
-	var err error
-	close(errCh)
-	for errIn := range errCh {
-		if errIn != badapi.ErrModeActive && errIn != badapi.ErrEmptyBody {
-			// err = multierror.Append(err, errIn)
-			err = errIn
+	availabilitySources := make([]*availabilitySource, len(mfs))
+	availabilityIts := make([]badapi.AvailabilityIterator, len(mfs))
+	for i, mf := range mfs {
+		availabilitySources[i] = s.loadAvailabilities(loadCtx, mf)
+		availabilityIts[i] = availabilitySources[i]
+	}
+
+	result, err := s.updater.Sync(ctx, productIts, availabilityIts)
+	cancelFn()
+	var productsErr, availabilitiesErr error
+	for _, source := range productSources {
+		<-source.done
+		report.Sources = append(report.Sources, source.report)
+		if source.report.Duration > report.LoadProductsTime {
+			report.LoadProductsTime = source.report.Duration
+		}
+		if source.report.Err != nil {
+			productsErr = source.report.Err
 		}
 	}
-	var clean [][]*badapi.Response
-	for _, avail := range availabilities {
-		if avail != nil {
-			clean = append(clean, avail)
+	for _, source := range availabilitySources {
+		<-source.done
+		report.Sources = append(report.Sources, source.report)
+		if source.report.Duration > report.LoadAvailabilitiesTime {
+			report.LoadAvailabilitiesTime = source.report.Duration
 		}
+		if errIn := source.report.Err; errIn != nil && errIn != badapi.ErrModeActive && errIn != badapi.ErrEmptyBody {
+			availabilitiesErr = errIn
+		}
+	}
+	report.WarehousePopulateTime = s.conf.Clock.Now().Sub(startAt)
+	report.ProcessedProducts = result.Products
+	report.ProcessedAvailabilities = result.Availabilities
+	report.QuarantinedAvailabilities = result.Quarantined
+	report.InFlightRecords = result.InFlight
+	report.Stages = result.Stages
+	if err != nil {
+		report.Err = err
+		return report, err
 	}
-	return &AvailabilityIterator{availabilities: clean}, err
+	if report.ExpiredAvailabilities, err = s.conf.WarehouseAPI.ExpireQuarantine(s.conf.Clock.Now().Add(-s.conf.QuarantineTTL)); err != nil {
+		report.Err = err
+		return report, err
+	}
+	report.Quarantine = s.conf.WarehouseAPI.QuarantineStats()
+	switch {
+	case productsErr != nil:
+		report.Err = xerrors.Errorf("failed to load products: %w", productsErr)
+		logger.WithField("info", "failed to load propducts").Error("update interrupted")
+		return report, nil
+	case availabilitiesErr != nil:
+		report.Err = xerrors.Errorf("failed to load availabilities: %w", availabilitiesErr)
+		logger.WithField("info", "failed to load availabilities").Error("update interrupted")
+		return report, nil
+	case ctx.Err() != nil:
+		report.Err = xerrors.Errorf("update interrupted: %w", ctx.Err())
+		logger.WithFields(logrus.Fields{
+			"info":                     ctx.Err().Error(),
+			"processed_products":       report.ProcessedProducts,
+			"processed_availabilities": report.ProcessedAvailabilities,
+			"in_flight_records":        report.InFlightRecords,
+		}).Error("update interrupted")
+		return report, nil
+	}
+
+	logger.WithFields(logrus.Fields{
+		"load_products_time":       report.LoadProductsTime.String(),
+		"load_availabilities_time": report.LoadAvailabilitiesTime.String(),
+		"warehouse_populate_time":  report.WarehousePopulateTime.String(),
+		"total_update_time":        s.conf.Clock.Now().Sub(startAt),
+		"processed_products":       report.ProcessedProducts,
+		"processed_availabilities": report.ProcessedAvailabilities,
+		"quarantined":              report.QuarantinedAvailabilities,
+		"quarantine_size":          report.Quarantine.Size,
+	}).Info("completed warehouse update")
+	return report, nil
 }
 
-type ProductIterator struct {
-	currRow int
-	currCol int
+// productSource is a badapi.ProductIterator over the products of a
+// category, loaded in the background. Next blocks until the products have
+// arrived. A failed load yields no products, its error is kept in report.
+type productSource struct {
+	done     chan struct{}
+	report   SourceReport
+	products []*badapi.Product
+	curr     int
+}
 
-	products [][]*badapi.Product
+// loadProducts starts loading the products of ctg.
+func (s *Service) loadProducts(ctx context.Context, ctg string) *productSource {
+	source := &productSource{done: make(chan struct{})}
+	go func() {
+		defer close(source.done)
+		startAt := s.conf.Clock.Now()
+		ctgProducts, err := badapi.Products(s.api).List(ctg).Context(ctx).Do()
+		source.report = SourceReport{Kind: SourceKindProducts, Name: ctg, Duration: s.conf.Clock.Now().Sub(startAt), Err: err}
+		if err != nil {
+			return
+		}
+		source.products = ctgProducts.Products
+		source.report.Records = len(ctgProducts.Products)
+		source.report.ContentHash = hashProducts(ctgProducts.Products)
+	}()
+	return source
 }
 
-func (i *ProductIterator) Next() bool {
-	if i.currRow >= len(i.products) && i.currCol >= len(i.products[i.currRow-1]) {
-		return false
-	}
-	if i.currRow == 0 && i.currCol == 0 {
-		i.currRow++
-		i.currCol++
-	} else if i.currRow < len(i.products) && i.currCol >= len(i.products[i.currRow-1]) {
-		i.currRow++
-		i.currCol = 1
-	} else {
-		i.currCol++
-	}
-	return true
+func (i *productSource) Next() bool {
+	<-i.done
+	i.curr++
+	return i.curr <= len(i.products)
 }
-func (i *ProductIterator) Error() error { return nil }
-func (i *ProductIterator) Close() error { return nil }
+func (i *productSource) Error() error { return nil }
+func (i *productSource) Close() error { return nil }
 
-func (i *ProductIterator) Product() *badapi.Product {
+func (i *productSource) Product() *badapi.Product {
 	productCopy := new(badapi.Product)
-	*productCopy = *i.products[i.currRow-1][i.currCol-1]
+	*productCopy = *i.products[i.curr-1]
 	return productCopy
 }
 
-type AvailabilityIterator struct {
-	currRow int
-	currCol int
+// availabilitySource is a badapi.AvailabilityIterator over the
+// availabilities of a manufacturer, loaded in the background. Next blocks
+// until the availabilities have arrived. A failed load yields no
+// availabilities, its error is kept in report.
+type availabilitySource struct {
+	done           chan struct{}
+	report         SourceReport
+	availabilities []*badapi.Response
+	curr           int
+}
 
-	availabilities [][]*badapi.Response
+// loadAvailabilities starts loading the availabilities of manufacturer.
+func (s *Service) loadAvailabilities(ctx context.Context, manufacturer string) *availabilitySource {
+	source := &availabilitySource{done: make(chan struct{})}
+	go func() {
+		defer close(source.done)
+		startAt := s.conf.Clock.Now()
+		mfAvailabilities, err := badapi.Availabilities(s.api).Get(manufacturer).Context(ctx).Do()
+		source.report = SourceReport{Kind: SourceKindAvailabilities, Name: manufacturer, Duration: s.conf.Clock.Now().Sub(startAt), Err: err}
+		if err != nil {
+			return
+		}
+		source.availabilities = mfAvailabilities.Response
+		source.report.Records = len(mfAvailabilities.Response)
+		source.report.ContentHash = hashAvailabilities(mfAvailabilities.Response)
+	}()
+	return source
 }
 
-func (i *AvailabilityIterator) Next() bool {
-	if i.currRow >= len(i.availabilities) && i.currCol >= len(i.availabilities[i.currRow-1]) {
-		return false
-	}
-	if i.currRow == 0 && i.currCol == 0 {
-		i.currRow++
-		i.currCol++
-	} else if i.currRow < len(i.availabilities) && i.currCol >= len(i.availabilities[i.currRow-1]) {
-		i.currRow++
-		i.currCol = 1
-	} else {
-		i.currCol++
-	}
-	return true
+func (i *availabilitySource) Next() bool {
+	<-i.done
+	i.curr++
+	return i.curr <= len(i.availabilities)
 }
-func (i *AvailabilityIterator) Error() error { return nil }
-func (i *AvailabilityIterator) Close() error { return nil }
+func (i *availabilitySource) Error() error { return nil }
+func (i *availabilitySource) Close() error { return nil }
 
-func (i *AvailabilityIterator) Availability() *badapi.Response {
+func (i *availabilitySource) Availability() *badapi.Response {
 	responseCopy := new(badapi.Response)
-	*responseCopy = *i.availabilities[i.currRow-1][i.currCol-1]
+	*responseCopy = *i.availabilities[i.curr-1]
 	return responseCopy
 }
+
+// hashProducts returns a content hash used to detect regenerated upstream
+// data.
+func hashProducts(products []*badapi.Product) uint64 {
+	hash := fnv.New64a()
+	for _, p := range products {
+		fmt.Fprintf(hash, "%s|%s|%s|%v|%d|%s\n", p.ID, p.Type, p.Name, p.Color, p.Price, p.Manufacturer)
+	}
+	return hash.Sum64()
+}
+
+// hashAvailabilities returns a content hash used to detect regenerated
+// upstream data.
+func hashAvailabilities(availabilities []*badapi.Response) uint64 {
+	hash := fnv.New64a()
+	for _, a := range availabilities {
+		fmt.Fprintf(hash, "%s|%s\n", a.ID, a.DataPayload)
+	}
+	return hash.Sum64()
+}
@@ -0,0 +1,128 @@
+package updater
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juju/clock/testclock"
+	"github.com/nikunicke/reaktorw/badapi"
+	"github.com/nikunicke/reaktorw/warehouse/inventory"
+	"github.com/nikunicke/reaktorw/warehouse/store/memory"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+// newEmptyBadAPI returns a server answering every request with an empty list.
+func newEmptyBadAPI() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "2")
+		_, _ = w.Write([]byte("[]"))
+	}))
+}
+
+var _ = check.Suite(new(QuarantineTestSuite))
+
+type QuarantineTestSuite struct{}
+
+func (s *QuarantineTestSuite) TestExpiresByWarehouseClock(c *check.C) {
+	srv := newEmptyBadAPI()
+	defer srv.Close()
+	clk := testclock.NewClock(time.Date(2021, 2, 27, 10, 0, 0, 0, time.UTC))
+	warehouse := memory.NewInMemoryWarehouse()
+	warehouse.UseClock(clk)
+	svc, err := NewService(Config{
+		WarehouseAPI:   warehouse,
+		BadAPI:         badapi.NewService().URL(srv.URL + "/"),
+		Clock:          clk,
+		UpdateInterval: time.Hour,
+		QuarantineTTL:  time.Hour,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(warehouse.QuarantineAvailability(&inventory.Availability{APIID: "unknown", Status: "INSTOCK"}), check.IsNil)
+
+	req := UpdateRequest{Categories: categories}
+	clk.Advance(59 * time.Minute)
+	report, err := svc.execute(context.TODO(), svc.newRun("", TriggerManual, req), 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.ExpiredAvailabilities, check.Equals, 0)
+	c.Assert(warehouse.QuarantineStats().Size, check.Equals, 1)
+
+	clk.Advance(2 * time.Minute)
+	report, err = svc.execute(context.TODO(), svc.newRun("", TriggerManual, req), 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.ExpiredAvailabilities, check.Equals, 1)
+	c.Assert(warehouse.QuarantineStats().Size, check.Equals, 0)
+}
+
+var _ = check.Suite(new(ReadinessTestSuite))
+
+type ReadinessTestSuite struct {
+	srv *httptest.Server
+	svc *Service
+}
+
+func (s *ReadinessTestSuite) SetUpTest(c *check.C) {
+	s.srv = newEmptyBadAPI()
+	var err error
+	s.svc, err = NewService(Config{
+		WarehouseAPI:   memory.NewInMemoryWarehouse(),
+		BadAPI:         badapi.NewService().URL(s.srv.URL + "/"),
+		UpdateInterval: time.Hour,
+	})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *ReadinessTestSuite) TearDownTest(c *check.C) {
+	s.srv.Close()
+}
+
+func (s *ReadinessTestSuite) TestReadyAfterSubscribers(c *check.C) {
+	var readyInSubscriber []bool
+	s.svc.Subscribe(func(Report) {
+		readyInSubscriber = append(readyInSubscriber, s.svc.Status().Ready)
+	})
+
+	_, err := s.svc.execute(context.TODO(), s.svc.newRun("", TriggerManual, UpdateRequest{Categories: categories}), 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(readyInSubscriber, check.DeepEquals, []bool{false})
+	c.Assert(s.svc.Status().Ready, check.Equals, true)
+}
+
+func (s *ReadinessTestSuite) TestFailedRunNotifiesSubscribers(c *check.C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := `[{"id":"a","type":"gloves","name":"glove"}]`
+		if strings.Contains(r.URL.Path, "beanies") {
+			body = "not json"
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	s.svc.api = badapi.NewService().URL(srv.URL + "/")
+	var reports []Report
+	s.svc.Subscribe(func(report Report) { reports = append(reports, report) })
+
+	report, err := s.svc.execute(context.TODO(), s.svc.newRun("", TriggerManual, UpdateRequest{Categories: categories}), 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(report.Err, check.NotNil)
+	// The other categories were written, so subscribers must see the failed
+	// run.
+	c.Assert(report.ProcessedProducts, check.Equals, 2)
+	c.Assert(reports, check.HasLen, 1)
+	c.Assert(s.svc.Status().Ready, check.Equals, false)
+}
+
+func (s *ReadinessTestSuite) TestReadyOnceEveryCategorySynced(c *check.C) {
+	for i, ctg := range categories {
+		c.Assert(s.svc.Status().Ready, check.Equals, false)
+		_, err := s.svc.execute(context.TODO(), s.svc.newRun("", TriggerManual, UpdateRequest{Categories: []string{ctg}}), 0)
+		c.Assert(err, check.IsNil)
+		c.Assert(s.svc.Status().Ready, check.Equals, i == len(categories)-1, check.Commentf("after %s", ctg))
+	}
+}
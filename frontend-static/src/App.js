@@ -17,16 +17,22 @@ const App = () => {
   useEffect(() => {
     glovesService.getAll().then(
       gloves => setGloves(gloves)
+    ).catch(
+      err => console.error(err)
     )
   }, [])
   useEffect(() => {
     facemasksService.getAll().then(
       beanies => setBeanies(beanies)
+    ).catch(
+      err => console.error(err)
     )
   }, [])
   useEffect(() => {
     beaniesService.getAll().then(
       facemasks => setFacemasks(facemasks)
+    ).catch(
+      err => console.error(err)
     )
   }, [])
 
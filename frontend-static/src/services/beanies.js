@@ -1,17 +1,14 @@
-import axios from 'axios'
-
-const baseURL = "/products/beanies/"
-
-const getAll = async () => {
-    console.log(baseURL)
-    const res = await axios.get(baseURL)
-    if (res.data === null)
-        res.data = []
-    return res.data
-}
-
-const shirtsService = {
-    getAll
-}
-
-export default shirtsService
+import getList from './request'
+
+const baseURL = "/products/beanies/"
+
+const getAll = () => {
+    console.log(baseURL)
+    return getList(baseURL)
+}
+
+const shirtsService = {
+    getAll
+}
+
+export default shirtsService
@@ -1,17 +1,14 @@
-import axios from 'axios'
-
-const baseURL = "/products/facemasks/"
-
-const getAll = async () => {
-    console.log(baseURL)
-    const res = await axios.get(baseURL)
-    if (res.data === null)
-        res.data = []
-    return res.data
-}
-
-const jacketsService = {
-    getAll
-}
-
-export default jacketsService
+import getList from './request'
+
+const baseURL = "/products/facemasks/"
+
+const getAll = () => {
+    console.log(baseURL)
+    return getList(baseURL)
+}
+
+const jacketsService = {
+    getAll
+}
+
+export default jacketsService
@@ -1,17 +1,14 @@
-import axios from 'axios'
-
-const baseURL = "/products/gloves/"
-
-const getAll = async () => {
-    console.log(baseURL)
-    const res = await axios.get(baseURL)
-    if (res.data === null)
-        res.data = []
-    return res.data
-}
-
-const accessoriesService = {
-    getAll
-}
-
-export default accessoriesService
+import getList from './request'
+
+const baseURL = "/products/gloves/"
+
+const getAll = () => {
+    console.log(baseURL)
+    return getList(baseURL)
+}
+
+const accessoriesService = {
+    getAll
+}
+
+export default accessoriesService
@@ -0,0 +1,43 @@
+import axios from 'axios'
+
+// the warehouse responds with 503 until its first update has completed
+const defaultRetryAfter = 5
+
+const sleep = (ms) => new Promise(resolve => setTimeout(resolve, ms))
+
+// retryDelay returns the delay in milliseconds the Retry-After header of res
+// asks for, given either in seconds or as an HTTP date.
+const retryDelay = (res) => {
+    const retryAfter = res.headers && res.headers['retry-after']
+    const seconds = Number(retryAfter)
+    if (retryAfter && !isNaN(seconds))
+        return seconds * 1000
+    const date = Date.parse(retryAfter)
+    if (!isNaN(date))
+        return Math.max(date - Date.now(), 0)
+    return defaultRetryAfter * 1000
+}
+
+// getList fetches a list of products, retrying while the warehouse is not
+// ready yet.
+const getList = async (url) => {
+    for (;;) {
+        try {
+            const res = await axios.get(url)
+            if (res.data === null)
+                res.data = []
+            return res.data
+        } catch (err) {
+            // categories without data respond with 404
+            if (err.response && err.response.status === 404)
+                return []
+            if (err.response && err.response.status === 503) {
+                await sleep(retryDelay(err.response))
+                continue
+            }
+            throw err
+        }
+    }
+}
+
+export default getList
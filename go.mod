@@ -3,11 +3,16 @@ module github.com/nikunicke/reaktorw
 go 1.15
 
 require (
+	github.com/andybalholm/brotli v1.0.2
 	github.com/google/uuid v1.2.0
 	github.com/gorilla/mux v1.8.0
 	github.com/hashicorp/go-multierror v1.1.0
 	github.com/juju/clock v0.0.0-20190205081909-9c5c9712527c
+	github.com/juju/errors v1.0.0 // indirect
+	github.com/juju/loggo v1.0.0 // indirect
 	github.com/kr/text v0.2.0 // indirect
+	github.com/prometheus/client_golang v1.9.0
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/rs/cors v1.7.0
 	github.com/sirupsen/logrus v1.8.0
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
@@ -0,0 +1,149 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// BatchProcessor processes payloads in bulk. It returns the payloads to pass
+// on to the next stage; payloads of the batch missing from the result are
+// marked as processed, so payloads must be comparable, e.g. pointers.
+// Returned payloads that were not part of the batch are counted as new
+// payloads of the pipeline. A failed batch is retried as a whole, so the processor must not modify the
+// batch or its payloads when it fails.
+type BatchProcessor interface {
+	ProcessBatch(context.Context, []Payload) ([]Payload, error)
+}
+
+type BatchProcessorFunc func(context.Context, []Payload) ([]Payload, error)
+
+func (f BatchProcessorFunc) ProcessBatch(ctx context.Context, batch []Payload) ([]Payload, error) {
+	return f(ctx, batch)
+}
+
+type batch struct {
+	proc    BatchProcessor
+	size    int
+	maxWait time.Duration
+	conf    stageConfig
+}
+
+// Batch collects payloads into batches of up to size payloads for proc. A
+// batch is flushed once it is full, maxWait after its first payload arrived,
+// or when the input is closed. A non-positive maxWait only flushes full
+// batches. The error policy applies to whole batches; every payload of a
+// failed batch is dead-lettered.
+func Batch(proc BatchProcessor, size int, maxWait time.Duration, opts ...StageOption) StageRunner {
+	if size <= 0 {
+		panic("pipeline: Batch size must be > 0")
+	}
+	return &batch{proc: proc, size: size, maxWait: maxWait, conf: newStageConfig(opts)}
+}
+
+func (r *batch) Run(ctx context.Context, params StageParams) {
+	var (
+		payloads = make([]Payload, 0, r.size)
+		timer    *time.Timer
+		timeout  <-chan time.Time
+	)
+	stopTimer := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, timeout = nil, nil
+		}
+	}
+	defer stopTimer()
+
+	for {
+		select {
+		case <-ctx.Done():
+			for _, payload := range payloads {
+				abandonPayload(payload)
+			}
+			return
+		case payloadIn, ok := <-params.Input():
+			if !ok {
+				if len(payloads) > 0 {
+					r.flush(ctx, params, payloads)
+				}
+				return
+			}
+			params.Observer().OnPayloadIn(params.StageIndex(), payloadIn)
+			if len(payloads) == 0 && r.maxWait > 0 {
+				timer = time.NewTimer(r.maxWait)
+				timeout = timer.C
+			}
+			payloads = append(payloads, payloadIn)
+			if len(payloads) < r.size {
+				continue
+			}
+		case <-timeout:
+		}
+		stopTimer()
+		if !r.flush(ctx, params, payloads) {
+			return
+		}
+		payloads = make([]Payload, 0, r.size)
+	}
+}
+
+// flush processes a batch and passes the results on. It reports whether the
+// stage may continue.
+func (r *batch) flush(ctx context.Context, params StageParams, payloads []Payload) bool {
+	startAt := time.Now()
+	payloadsOut, err := r.proc.ProcessBatch(ctx, payloads)
+	err = r.conf.policy.retry(ctx, err, func() (err error) {
+		payloadsOut, err = r.proc.ProcessBatch(ctx, payloads)
+		return err
+	})
+	duration := time.Since(startAt)
+	if err != nil {
+		params.Observer().OnError(params.StageIndex(), nil, err, duration)
+		stageErr := newStageError(params.StageIndex(), nil, xerrors.Errorf("batch of %d: %w", len(payloads), err))
+		for i, payload := range payloads {
+			if !deadLetterPayload(ctx, params, payload, err) {
+				for _, payload := range payloads[i:] {
+					abandonPayload(payload)
+				}
+				return false
+			}
+		}
+		if !r.conf.policy.skip {
+			emitError(stageErr, params.Error())
+			return false
+		}
+		return true
+	}
+
+	batched := make(map[Payload]struct{}, len(payloads))
+	for _, payload := range payloads {
+		batched[payload] = struct{}{}
+	}
+	kept := make(map[Payload]struct{}, len(payloadsOut))
+	for _, payload := range payloadsOut {
+		if _, ok := batched[payload]; !ok {
+			createPayload(params)
+		}
+		kept[payload] = struct{}{}
+		params.Observer().OnPayloadOut(params.StageIndex(), payload, duration)
+	}
+	for _, payload := range payloads {
+		if _, ok := kept[payload]; !ok {
+			params.Observer().OnPayloadOut(params.StageIndex(), nil, duration)
+			dropPayload(params, payload)
+		}
+	}
+	for i, payload := range payloadsOut {
+		select {
+		case params.Output() <- payload:
+		case <-ctx.Done():
+			for _, payload := range payloadsOut[i:] {
+				abandonPayload(payload)
+			}
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,172 @@
+package pipeline_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nikunicke/reaktorw/pipeline"
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(BatchTestSuite))
+
+type BatchTestSuite struct{}
+
+// batchRecorder records the size of every batch and keeps the payloads
+// keep accepts. It fails batches containing a payload divisible by failOn.
+type batchRecorder struct {
+	mu     sync.Mutex
+	sizes  []int
+	keep   func(int) bool
+	failOn int
+}
+
+func (r *batchRecorder) ProcessBatch(_ context.Context, batch []pipeline.Payload) ([]pipeline.Payload, error) {
+	r.mu.Lock()
+	r.sizes = append(r.sizes, len(batch))
+	r.mu.Unlock()
+	var out []pipeline.Payload
+	for _, p := range batch {
+		val := p.(*testPayload).val
+		if r.failOn > 0 && val%r.failOn == 0 {
+			return nil, fmt.Errorf("failed %d", val)
+		}
+		if r.keep == nil || r.keep(val) {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (r *batchRecorder) batchSizes() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int(nil), r.sizes...)
+}
+
+func (s *BatchTestSuite) TestFlushesFullBatches(c *check.C) {
+	proc := new(batchRecorder)
+	src, sink := newSourceStub(0, 23), new(sinkStub)
+
+	res, err := pipeline.New(pipeline.Batch(proc, 10, 0)).Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	// The last batch is flushed when the input closes.
+	c.Assert(proc.batchSizes(), check.DeepEquals, []int{10, 10, 3})
+	c.Assert(sink.values(), check.DeepEquals, sequence(0, 23, nil))
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 23})
+	assertReleasedOnce(c, src.emitted())
+}
+
+func (s *BatchTestSuite) TestFlushesAfterMaxWait(c *check.C) {
+	proc := new(batchRecorder)
+	src, sink := newSourceStub(0, 4), new(sinkStub)
+	src.delay = 20 * time.Millisecond
+
+	res, err := pipeline.New(pipeline.Batch(proc, 10, 5*time.Millisecond)).Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	c.Assert(proc.batchSizes(), check.DeepEquals, []int{1, 1, 1, 1})
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 4})
+	assertReleasedOnce(c, src.emitted())
+}
+
+func (s *BatchTestSuite) TestDropsFilteredPayloads(c *check.C) {
+	isOdd := func(i int) bool { return i%2 == 1 }
+	src, sink := newSourceStub(0, 20), new(sinkStub)
+
+	res, err := pipeline.New(pipeline.Batch(&batchRecorder{keep: isOdd}, 8, 0)).Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	c.Assert(sink.values(), check.DeepEquals, sequence(0, 20, func(i int) bool { return !isOdd(i) }))
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 10, Dropped: 10})
+	assertReleasedOnce(c, src.emitted())
+}
+
+func (s *BatchTestSuite) TestSkipOnErrorDeadLettersBatch(c *check.C) {
+	src, sink, dl := newSourceStub(1, 21), new(sinkStub), new(deadLetterStub)
+	p := pipeline.New(
+		pipeline.Batch(&batchRecorder{failOn: 7}, 5, 0, pipeline.WithErrorPolicy(pipeline.SkipOnError())),
+	).WithDeadLetter(dl)
+
+	res, err := p.Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	// 7 and 14 fail the batches 6-10 and 11-15.
+	isFailed := func(i int) bool { return i >= 6 && i <= 15 }
+	c.Assert(sink.values(), check.DeepEquals, sequence(1, 21, isFailed))
+	c.Assert(dl.values(), check.DeepEquals, sequence(6, 16, nil))
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 10, Dropped: 10})
+	assertReleasedOnce(c, src.emitted())
+}
+
+func (s *BatchTestSuite) TestFailOnErrorStops(c *check.C) {
+	src, sink := newSourceStub(1, 1000), new(sinkStub)
+	res, err := pipeline.New(pipeline.Batch(&batchRecorder{failOn: 50}, 10, 0)).Process(context.TODO(), sink, src)
+	c.Assert(err, check.ErrorMatches, "(?s).*batch of 10: failed 50.*")
+	c.Assert(len(sink.values()) < 999, check.Equals, true)
+	c.Assert(res.Completed+res.Dropped+res.InFlight, check.Equals, len(src.emitted()))
+	assertReleasedOnce(c, src.emitted())
+}
+
+func (s *BatchTestSuite) TestCancel(c *check.C) {
+	ctx, cancelFn := context.WithCancel(context.Background())
+	src, sink := newSourceStub(0, 1000), new(sinkStub)
+	p := pipeline.New(
+		pipeline.FIFO(cancelAfter(25, cancelFn)),
+		pipeline.Batch(new(batchRecorder), 10, 0),
+	)
+
+	res, err := p.Process(ctx, sink, src)
+	c.Assert(err, check.IsNil)
+	c.Assert(len(src.emitted()) < 1000, check.Equals, true)
+	c.Assert(res.Completed+res.InFlight, check.Equals, len(src.emitted()))
+	assertReleasedOnce(c, src.emitted())
+}
+
+// failingDeadLetter accepts limit dead letters and fails the rest.
+type failingDeadLetter struct {
+	mu    sync.Mutex
+	limit int
+}
+
+func (s *failingDeadLetter) Consume(context.Context, pipeline.Payload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.limit == 0 {
+		return fmt.Errorf("dead-letter sink full")
+	}
+	s.limit--
+	return nil
+}
+
+func (s *BatchTestSuite) TestDeadLetterFailureReleasesBatch(c *check.C) {
+	src, sink := newSourceStub(1, 11), new(sinkStub)
+	p := pipeline.New(
+		pipeline.Batch(&batchRecorder{failOn: 3}, 5, 0, pipeline.WithErrorPolicy(pipeline.SkipOnError())),
+	).WithDeadLetter(&failingDeadLetter{limit: 2})
+
+	res, err := p.Process(context.TODO(), sink, src)
+	c.Assert(err, check.ErrorMatches, "(?s).*dead-letter failed 3: dead-letter sink full.*")
+	// Two payloads of the first batch were dead-lettered; the other three
+	// were left in flight.
+	c.Assert(res.Dropped, check.Equals, 2)
+	c.Assert(res.Completed+res.Dropped+res.InFlight, check.Equals, len(src.emitted()))
+	assertReleasedOnce(c, src.emitted())
+}
+
+func (s *BatchTestSuite) TestCountsCreatedPayloads(c *check.C) {
+	// sum replaces every batch with a payload holding the sum of its values.
+	sum := pipeline.BatchProcessorFunc(func(_ context.Context, batch []pipeline.Payload) ([]pipeline.Payload, error) {
+		total := 0
+		for _, p := range batch {
+			total += p.(*testPayload).val
+		}
+		return []pipeline.Payload{&testPayload{val: total}}, nil
+	})
+	src, sink := newSourceStub(0, 10), new(sinkStub)
+
+	res, err := pipeline.New(pipeline.Batch(sum, 4, 0)).Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	c.Assert(sink.values(), check.DeepEquals, []int{6, 22, 17})
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 3, Dropped: 10})
+	assertReleasedOnce(c, src.emitted())
+}
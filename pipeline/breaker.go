@@ -0,0 +1,76 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrCircuitOpen is returned by a CircuitBreaker processor for the payloads
+// it short-circuits.
+var ErrCircuitOpen = xerrors.New("pipeline: circuit breaker open")
+
+type circuitBreaker struct {
+	proc      Processor
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// CircuitBreaker wraps proc to stop calling it after threshold consecutive
+// errors. While the breaker is open, payloads fail with ErrCircuitOpen
+// without reaching proc, so with SkipOnError they are short-circuited to the
+// pipeline's dead-letter sink. After cooldown a single payload is let through
+// to probe proc, closing the breaker if it succeeds and reopening it
+// otherwise. The breaker is shared by all workers of a stage.
+func CircuitBreaker(proc Processor, threshold int, cooldown time.Duration) Processor {
+	if threshold <= 0 {
+		panic("pipeline: CircuitBreaker threshold must be > 0")
+	}
+	return &circuitBreaker{proc: proc, threshold: threshold, cooldown: cooldown}
+}
+
+func (b *circuitBreaker) Process(ctx context.Context, payload Payload) (Payload, error) {
+	probe, err := b.allow()
+	if err != nil {
+		return nil, err
+	}
+	payloadOut, err := b.proc.Process(ctx, payload)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	if err == nil {
+		b.failures = 0
+		return payloadOut, nil
+	}
+	// Failures of calls made before the breaker opened do not extend its
+	// cooldown; only opening it and failed probes do.
+	if b.failures++; b.failures == b.threshold || probe {
+		b.openedAt = time.Now()
+	}
+	return payloadOut, err
+}
+
+// allow reports whether proc may be called, and whether the call probes an
+// open breaker.
+func (b *circuitBreaker) allow() (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return false, nil
+	}
+	if b.probing || time.Since(b.openedAt) < b.cooldown {
+		return false, ErrCircuitOpen
+	}
+	b.probing = true
+	return true, nil
+}
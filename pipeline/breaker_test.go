@@ -0,0 +1,131 @@
+package pipeline_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/nikunicke/reaktorw/pipeline"
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(CircuitBreakerTestSuite))
+
+type CircuitBreakerTestSuite struct{}
+
+// backend is a processor failing while down is set, counting its calls.
+type backend struct {
+	calls int32
+	down  int32
+}
+
+func (b *backend) Process(_ context.Context, p pipeline.Payload) (pipeline.Payload, error) {
+	atomic.AddInt32(&b.calls, 1)
+	if atomic.LoadInt32(&b.down) == 1 {
+		return p, fmt.Errorf("backend down")
+	}
+	return p, nil
+}
+
+func (s *CircuitBreakerTestSuite) TestOpensAfterThreshold(c *check.C) {
+	b := &backend{down: 1}
+	src, sink, dl := newSourceStub(0, 50), new(sinkStub), new(deadLetterStub)
+	p := pipeline.New(
+		pipeline.FixedWorkerPool(pipeline.CircuitBreaker(b, 3, time.Hour), 4, pipeline.WithErrorPolicy(pipeline.SkipOnError())),
+	).WithDeadLetter(dl)
+
+	res, err := p.Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	// Workers racing the third failure may each reach the backend once.
+	c.Assert(atomic.LoadInt32(&b.calls) >= 3 && atomic.LoadInt32(&b.calls) <= 6, check.Equals, true)
+	c.Assert(dl.values(), check.HasLen, 50)
+	c.Assert(res, check.Equals, pipeline.Result{Dropped: 50})
+	assertReleasedOnce(c, src.emitted())
+}
+
+func (s *CircuitBreakerTestSuite) TestProbesAfterCooldown(c *check.C) {
+	b := &backend{down: 1}
+	breaker := pipeline.CircuitBreaker(b, 2, 10*time.Millisecond)
+	process := func() error {
+		_, err := breaker.Process(context.TODO(), &testPayload{})
+		return err
+	}
+
+	c.Assert(process(), check.ErrorMatches, "backend down")
+	c.Assert(process(), check.ErrorMatches, "backend down")
+	c.Assert(process(), check.Equals, pipeline.ErrCircuitOpen)
+	c.Assert(atomic.LoadInt32(&b.calls), check.Equals, int32(2))
+
+	// A failed probe reopens the breaker.
+	time.Sleep(15 * time.Millisecond)
+	c.Assert(process(), check.ErrorMatches, "backend down")
+	c.Assert(process(), check.Equals, pipeline.ErrCircuitOpen)
+
+	// A successful probe closes it.
+	atomic.StoreInt32(&b.down, 0)
+	time.Sleep(15 * time.Millisecond)
+	c.Assert(process(), check.IsNil)
+	c.Assert(process(), check.IsNil)
+	c.Assert(atomic.LoadInt32(&b.calls), check.Equals, int32(5))
+}
+
+// blocking returns a processor failing every payload, holding back those
+// with value val until release is closed. It signals on started when it
+// holds one back.
+func blocking(val int, started, release chan struct{}) pipeline.Processor {
+	return pipeline.ProcessorFunc(func(_ context.Context, p pipeline.Payload) (pipeline.Payload, error) {
+		if p.(*testPayload).val == val {
+			started <- struct{}{}
+			<-release
+		}
+		return p, fmt.Errorf("backend down")
+	})
+}
+
+func (s *CircuitBreakerTestSuite) TestSingleProbeWhileHalfOpen(c *check.C) {
+	started, release := make(chan struct{}), make(chan struct{})
+	breaker := pipeline.CircuitBreaker(blocking(1, started, release), 1, 10*time.Millisecond)
+
+	_, err := breaker.Process(context.TODO(), &testPayload{val: 0})
+	c.Assert(err, check.ErrorMatches, "backend down")
+	time.Sleep(15 * time.Millisecond)
+	probeErr := make(chan error)
+	go func() {
+		_, err := breaker.Process(context.TODO(), &testPayload{val: 1})
+		probeErr <- err
+	}()
+	<-started
+
+	// Payloads arriving while the probe is in flight are short-circuited.
+	_, err = breaker.Process(context.TODO(), &testPayload{val: 2})
+	c.Assert(err, check.Equals, pipeline.ErrCircuitOpen)
+	close(release)
+	c.Assert(<-probeErr, check.ErrorMatches, "backend down")
+	_, err = breaker.Process(context.TODO(), &testPayload{val: 2})
+	c.Assert(err, check.Equals, pipeline.ErrCircuitOpen)
+}
+
+func (s *CircuitBreakerTestSuite) TestInFlightFailuresDoNotExtendCooldown(c *check.C) {
+	started, release := make(chan struct{}), make(chan struct{})
+	breaker := pipeline.CircuitBreaker(blocking(0, started, release), 1, 50*time.Millisecond)
+	inFlightErr := make(chan error)
+	go func() {
+		_, err := breaker.Process(context.TODO(), &testPayload{val: 0})
+		inFlightErr <- err
+	}()
+	<-started
+
+	// The breaker opens while the first call is still in flight, which then
+	// fails shortly before the cooldown ends.
+	_, err := breaker.Process(context.TODO(), &testPayload{val: 1})
+	c.Assert(err, check.ErrorMatches, "backend down")
+	time.Sleep(40 * time.Millisecond)
+	close(release)
+	c.Assert(<-inFlightErr, check.ErrorMatches, "backend down")
+
+	// The cooldown still ends 50ms after the breaker opened.
+	time.Sleep(20 * time.Millisecond)
+	_, err = breaker.Process(context.TODO(), &testPayload{val: 2})
+	c.Assert(err, check.ErrorMatches, "backend down")
+}
@@ -0,0 +1,117 @@
+package pipeline
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Result counts the payloads of a Process call. Every payload read from the
+// source or created by a stage, such as the copies made by Broadcast, is
+// either completed by the sink, dropped by a stage or the queues, or left in
+// flight when processing was cancelled. Payloads left in flight by the
+// runners of this package are marked as processed.
+type Result struct {
+	Completed int
+	Dropped   int
+	InFlight  int
+}
+
+// WithDrain enables drain mode: when the context passed to Process is
+// cancelled, the source is stopped but the payloads already read keep
+// flowing through the stages to the sink for up to timeout. The stages are
+// then cancelled, leaving the remaining payloads in flight. Errors still
+// cancel all stages at once.
+func (p *Pipeline) WithDrain(timeout time.Duration) *Pipeline {
+	p.drain = true
+	p.drainTimeout = timeout
+	return p
+}
+
+// stageContext returns the context of the stages. In drain mode it outlives
+// ctx by up to the drain timeout.
+func (p *Pipeline) stageContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if !p.drain {
+		return context.WithCancel(ctx)
+	}
+	stageCtx, cancelFn := context.WithCancel(detachedContext{parent: ctx})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stageCtx.Done():
+			return
+		}
+		timer := time.NewTimer(p.drainTimeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancelFn()
+		case <-stageCtx.Done():
+		}
+	}()
+	return stageCtx, cancelFn
+}
+
+// detachedContext carries the values of its parent but not its deadline or
+// cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+type payloadCounts struct {
+	created   int64
+	completed int64
+	dropped   int64
+}
+
+func (c *payloadCounts) result() Result {
+	completed := int(atomic.LoadInt64(&c.completed))
+	dropped := int(atomic.LoadInt64(&c.dropped))
+	return Result{
+		Completed: completed,
+		Dropped:   dropped,
+		InFlight:  int(atomic.LoadInt64(&c.created)) - completed - dropped,
+	}
+}
+
+// counts returns the payload counts of the Process call params belong to,
+// or nil for StageParams implemented elsewhere.
+func counts(params StageParams) *payloadCounts {
+	if wp, ok := params.(*workerParams); ok {
+		return wp.counts
+	}
+	return nil
+}
+
+// dropPayload marks a payload a stage does not pass on as processed.
+func dropPayload(params StageParams, payload Payload) {
+	payload.MarkAsProcessed()
+	if c := counts(params); c != nil {
+		atomic.AddInt64(&c.dropped, 1)
+	}
+}
+
+// clonePayload returns a copy of payload counted as a new payload.
+func clonePayload(params StageParams, payload Payload) Payload {
+	createPayload(params)
+	return payload.Clone()
+}
+
+// createPayload counts a payload a stage passes on without having received it.
+func createPayload(params StageParams) {
+	if c := counts(params); c != nil {
+		atomic.AddInt64(&c.created, 1)
+	}
+}
+
+// abandonPayload marks a payload left in flight by cancellation as processed.
+func abandonPayload(payload Payload) {
+	if payload != nil {
+		payload.MarkAsProcessed()
+	}
+}
@@ -0,0 +1,88 @@
+package pipeline_test
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/nikunicke/reaktorw/pipeline"
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(DrainTestSuite))
+
+type DrainTestSuite struct{}
+
+// stubbornSource ignores the context passed to Next.
+type stubbornSource struct {
+	*sourceStub
+}
+
+func (s stubbornSource) Next(context.Context) bool { return s.sourceStub.Next(context.Background()) }
+
+// cancelAfter returns a processor cancelling cancelFn once n payloads have
+// passed it.
+func cancelAfter(n int32, cancelFn context.CancelFunc) pipeline.Processor {
+	var seen int32
+	return pipeline.ProcessorFunc(func(_ context.Context, p pipeline.Payload) (pipeline.Payload, error) {
+		if atomic.AddInt32(&seen, 1) == n {
+			cancelFn()
+		}
+		time.Sleep(100 * time.Microsecond)
+		return p, nil
+	})
+}
+
+func (s *DrainTestSuite) TestDrainStopsSourceIgnoringContext(c *check.C) {
+	for _, policy := range []pipeline.MergePolicy{pipeline.InterleaveAsReady, pipeline.RoundRobin, pipeline.Priority} {
+		ctx, cancelFn := context.WithCancel(context.Background())
+		srcA, srcB := newSourceStub(0, 1000), newSourceStub(1000, 2000)
+		sink := new(sinkStub)
+		p := pipeline.New(
+			pipeline.FIFO(cancelAfter(50, cancelFn)),
+		).WithDrain(time.Second).WithMergePolicy(policy).WithQueues(pipeline.QueueConfig{Size: 4})
+
+		res, err := p.Process(ctx, sink, stubbornSource{srcA}, stubbornSource{srcB})
+		c.Assert(err, check.IsNil)
+		emitted := append(srcA.emitted(), srcB.emitted()...)
+		c.Assert(len(emitted) < 100, check.Equals, true, check.Commentf("policy %d read %d payloads", policy, len(emitted)))
+		// Everything read before the cancellation is drained to the sink.
+		c.Assert(res, check.Equals, pipeline.Result{Completed: len(emitted)})
+		c.Assert(sink.values(), check.HasLen, len(emitted))
+		assertReleasedOnce(c, emitted)
+	}
+}
+
+func (s *DrainTestSuite) TestDrainTimeoutLeavesPayloadsInFlight(c *check.C) {
+	ctx, cancelFn := context.WithCancel(context.Background())
+	src, sink := newSourceStub(0, 1000), new(sinkStub)
+	slow := pipeline.ProcessorFunc(func(ctx context.Context, p pipeline.Payload) (pipeline.Payload, error) {
+		time.Sleep(20 * time.Millisecond)
+		return p, nil
+	})
+	p := pipeline.New(
+		pipeline.FIFO(cancelAfter(1, cancelFn)),
+		pipeline.FIFO(slow),
+	).WithDrain(30 * time.Millisecond).WithQueues(pipeline.QueueConfig{Size: 10})
+
+	res, err := p.Process(ctx, sink, src)
+	c.Assert(err, check.IsNil)
+	c.Assert(res.InFlight > 0, check.Equals, true)
+	c.Assert(res.Completed+res.InFlight, check.Equals, len(src.emitted()))
+	assertReleasedOnce(c, src.emitted())
+}
+
+func (s *DrainTestSuite) TestCancelWithoutDrain(c *check.C) {
+	ctx, cancelFn := context.WithCancel(context.Background())
+	src, sink := newSourceStub(0, 1000), new(sinkStub)
+	p := pipeline.New(
+		pipeline.FIFO(cancelAfter(20, cancelFn)),
+		pipeline.FixedWorkerPool(identity(), 2),
+	).WithQueues(pipeline.QueueConfig{Size: 4})
+
+	res, err := p.Process(ctx, sink, stubbornSource{src})
+	c.Assert(err, check.IsNil)
+	c.Assert(res.Completed+res.Dropped+res.InFlight, check.Equals, len(src.emitted()))
+	c.Assert(len(src.emitted()) < 1000, check.Equals, true)
+	assertReleasedOnce(c, src.emitted())
+}
@@ -0,0 +1,97 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+)
+
+// ErrorPolicy decides what a stage does with a payload its processor failed
+// on. Every failed payload is first sent to the pipeline's dead-letter sink,
+// if there is one.
+type ErrorPolicy struct {
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	skip       bool
+}
+
+// FailOnError aborts the pipeline on the first failed payload. This is the
+// default policy of every stage.
+func FailOnError() ErrorPolicy { return ErrorPolicy{} }
+
+// SkipOnError drops failed payloads and keeps the stage running.
+func SkipOnError() ErrorPolicy { return ErrorPolicy{skip: true} }
+
+// RetryOnError processes a failed payload up to retries more times before
+// applying then. The payload is retried immediately and as it was passed to
+// the failed attempt, so processors must not modify a payload they fail on.
+func RetryOnError(retries int, then ErrorPolicy) ErrorPolicy {
+	then.retries = retries
+	return then
+}
+
+// RetryWithBackoff is RetryOnError waiting before each retry, for backoff at
+// first and twice as long after every failed retry, up to maxBackoff.
+func RetryWithBackoff(retries int, backoff, maxBackoff time.Duration, then ErrorPolicy) ErrorPolicy {
+	then = RetryOnError(retries, then)
+	then.backoff, then.maxBackoff = backoff, maxBackoff
+	return then
+}
+
+// retry calls fn again while it fails, up to the retries of the policy,
+// backing off between attempts. It returns the last error of fn, or the
+// error of ctx if it was cancelled while backing off.
+func (p ErrorPolicy) retry(ctx context.Context, err error, fn func() error) error {
+	backoff := p.backoff
+	for attempt := 0; err != nil && attempt < p.retries && ctx.Err() == nil; attempt++ {
+		if backoff > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			}
+			if backoff *= 2; p.maxBackoff > 0 && backoff > p.maxBackoff {
+				backoff = p.maxBackoff
+			}
+		}
+		err = fn()
+	}
+	return err
+}
+
+// StageOption configures a stage runner.
+type StageOption func(*stageConfig)
+
+type stageConfig struct {
+	policy ErrorPolicy
+}
+
+// WithErrorPolicy sets the error policy of a stage.
+func WithErrorPolicy(policy ErrorPolicy) StageOption {
+	return func(c *stageConfig) { c.policy = policy }
+}
+
+func newStageConfig(opts []StageOption) stageConfig {
+	var conf stageConfig
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	return conf
+}
+
+// DeadLetter is consumed by the dead-letter sink for every payload a stage
+// failed to process. The payload is marked as processed once the sink
+// returns, so the sink must copy whatever it keeps.
+type DeadLetter struct {
+	Payload    Payload
+	StageIndex int
+	Err        error
+}
+
+func (d *DeadLetter) Clone() Payload {
+	return &DeadLetter{Payload: d.Payload.Clone(), StageIndex: d.StageIndex, Err: d.Err}
+}
+
+func (d *DeadLetter) MarkAsProcessed() { d.Payload.MarkAsProcessed() }
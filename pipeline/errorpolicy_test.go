@@ -0,0 +1,114 @@
+package pipeline_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nikunicke/reaktorw/pipeline"
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(ErrorPolicyTestSuite))
+
+type ErrorPolicyTestSuite struct{}
+
+// flaky is a processor failing the first failures attempts of every payload,
+// recording when each attempt was made.
+type flaky struct {
+	mu       sync.Mutex
+	failures int
+	attempts map[int][]time.Time
+}
+
+func (f *flaky) Process(_ context.Context, p pipeline.Payload) (pipeline.Payload, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.attempts == nil {
+		f.attempts = make(map[int][]time.Time)
+	}
+	val := p.(*testPayload).val
+	f.attempts[val] = append(f.attempts[val], time.Now())
+	if len(f.attempts[val]) <= f.failures {
+		return nil, fmt.Errorf("failed %d", val)
+	}
+	return p, nil
+}
+
+// ProcessBatch fails a batch as often as its first payload.
+func (f *flaky) ProcessBatch(ctx context.Context, batch []pipeline.Payload) ([]pipeline.Payload, error) {
+	if _, err := f.Process(ctx, batch[0]); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// delays returns the time between the attempts of the payload val.
+func (f *flaky) delays(val int) []time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var delays []time.Duration
+	for i := 1; i < len(f.attempts[val]); i++ {
+		delays = append(delays, f.attempts[val][i].Sub(f.attempts[val][i-1]))
+	}
+	return delays
+}
+
+// assertBackedOff checks that the retries of the payload val waited 10ms and
+// then 15ms between attempts.
+func assertBackedOff(c *check.C, proc *flaky, val int) {
+	delays := proc.delays(val)
+	c.Assert(delays, check.HasLen, 3)
+	for i, min := range []time.Duration{10 * time.Millisecond, 15 * time.Millisecond, 15 * time.Millisecond} {
+		c.Assert(delays[i] >= min, check.Equals, true, check.Commentf("retry %d after %s", i, delays[i]))
+	}
+}
+
+var backoffPolicy = pipeline.RetryWithBackoff(3, 10*time.Millisecond, 15*time.Millisecond, pipeline.FailOnError())
+
+func (s *ErrorPolicyTestSuite) TestRetryWithBackoff(c *check.C) {
+	proc := &flaky{failures: 3}
+	src, sink := newSourceStub(0, 2), new(sinkStub)
+
+	res, err := pipeline.New(pipeline.FIFO(proc, pipeline.WithErrorPolicy(backoffPolicy))).Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 2})
+	assertBackedOff(c, proc, 0)
+	assertBackedOff(c, proc, 1)
+}
+
+func (s *ErrorPolicyTestSuite) TestBatchRetryWithBackoff(c *check.C) {
+	proc := &flaky{failures: 3}
+	src, sink := newSourceStub(0, 2), new(sinkStub)
+
+	res, err := pipeline.New(pipeline.Batch(proc, 2, 0, pipeline.WithErrorPolicy(backoffPolicy))).Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 2})
+	assertBackedOff(c, proc, 0)
+}
+
+func (s *ErrorPolicyTestSuite) TestRetriesGiveUp(c *check.C) {
+	proc := &flaky{failures: 4}
+	src, sink := newSourceStub(0, 1), new(sinkStub)
+
+	res, err := pipeline.New(pipeline.FIFO(proc, pipeline.WithErrorPolicy(backoffPolicy))).Process(context.TODO(), sink, src)
+	c.Assert(err, check.ErrorMatches, "(?s).*failed 0.*")
+	c.Assert(res, check.Equals, pipeline.Result{Dropped: 1})
+	assertBackedOff(c, proc, 0)
+}
+
+func (s *ErrorPolicyTestSuite) TestCancelWhileBackingOff(c *check.C) {
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+	proc := &flaky{failures: 1}
+	src, sink := newSourceStub(0, 1), new(sinkStub)
+	policy := pipeline.RetryWithBackoff(1, time.Hour, time.Hour, pipeline.FailOnError())
+	time.AfterFunc(10*time.Millisecond, cancelFn)
+
+	startAt := time.Now()
+	_, _ = pipeline.New(pipeline.FIFO(proc, pipeline.WithErrorPolicy(policy))).Process(ctx, sink, src)
+	c.Assert(time.Since(startAt) < time.Second, check.Equals, true)
+	c.Assert(proc.delays(0), check.HasLen, 0)
+	assertReleasedOnce(c, src.emitted())
+}
@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Stage indices reported by StageError for errors of the source and sink.
+const (
+	SourceStage = -1
+	SinkStage   = -2
+)
+
+// StageError wraps an error a pipeline failed with, telling where it
+// happened. Errors returned by Pipeline.Process can be inspected with
+// xerrors.As.
+type StageError struct {
+	StageIndex int
+	// Payload describes the payload being processed, if any. Payloads
+	// implementing fmt.Stringer describe themselves.
+	Payload string
+	Err     error
+}
+
+func newStageError(stageIndex int, payload Payload, err error) *StageError {
+	stageErr := &StageError{StageIndex: stageIndex, Err: err}
+	if stringer, ok := payload.(fmt.Stringer); ok {
+		stageErr.Payload = stringer.String()
+	} else if payload != nil {
+		stageErr.Payload = fmt.Sprintf("%T", payload)
+	}
+	return stageErr
+}
+
+func (e *StageError) Error() string {
+	var where string
+	switch e.StageIndex {
+	case SourceStage:
+		where = "pipeline source"
+	case SinkStage:
+		where = "pipeline sink"
+	default:
+		where = "pipeline stage " + strconv.Itoa(e.StageIndex)
+	}
+	if e.Payload != "" {
+		where += " (" + e.Payload + ")"
+	}
+	return where + ": " + e.Err.Error()
+}
+
+func (e *StageError) Unwrap() error { return e.Err }
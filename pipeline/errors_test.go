@@ -0,0 +1,68 @@
+package pipeline_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/nikunicke/reaktorw/pipeline"
+	"golang.org/x/xerrors"
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(StageErrorTestSuite))
+
+type StageErrorTestSuite struct{}
+
+func (s *StageErrorTestSuite) TestStageErrorAs(c *check.C) {
+	src, sink := newSourceStub(1, 10), new(sinkStub)
+	p := pipeline.New(pipeline.FIFO(identity()), pipeline.FIFO(failing(4, 0)))
+
+	_, err := p.Process(context.TODO(), sink, src)
+	var stageErr *pipeline.StageError
+	c.Assert(xerrors.As(err, &stageErr), check.Equals, true)
+	c.Assert(stageErr.StageIndex, check.Equals, 1)
+	c.Assert(stageErr.Payload, check.Equals, "4")
+	c.Assert(stageErr.Err, check.ErrorMatches, "failed 4")
+	c.Assert(stageErr, check.ErrorMatches, `pipeline stage 1 \(4\): failed 4`)
+}
+
+func (s *StageErrorTestSuite) TestErrorsOfSeveralStagesAggregated(c *check.C) {
+	// Each stage fails one payload, but only once both have one to fail, so
+	// neither error cancels the other stage first.
+	var failed sync.WaitGroup
+	failed.Add(2)
+	failOn := func(val int) pipeline.Processor {
+		return pipeline.ProcessorFunc(func(_ context.Context, p pipeline.Payload) (pipeline.Payload, error) {
+			if p.(*testPayload).val != val {
+				return p, nil
+			}
+			failed.Done()
+			failed.Wait()
+			return nil, fmt.Errorf("failed %d", val)
+		})
+	}
+	src, sink := newSourceStub(0, 10), new(sinkStub)
+	p := pipeline.New(pipeline.FIFO(failOn(1)), pipeline.FIFO(failOn(0)))
+
+	_, err := p.Process(context.TODO(), sink, src)
+	c.Assert(stageErrors(c, err), check.DeepEquals, map[int]string{
+		0: "pipeline stage 0 (1): failed 1",
+		1: "pipeline stage 1 (0): failed 0",
+	})
+}
+
+// stageErrors returns the messages of the stage errors aggregated in err by
+// stage index.
+func stageErrors(c *check.C, err error) map[int]string {
+	var errs *multierror.Error
+	c.Assert(xerrors.As(err, &errs), check.Equals, true)
+	indices := make(map[int]string)
+	for _, err := range errs.WrappedErrors() {
+		var stageErr *pipeline.StageError
+		c.Assert(xerrors.As(err, &stageErr), check.Equals, true)
+		indices[stageErr.StageIndex] = stageErr.Error()
+	}
+	return indices
+}
@@ -2,7 +2,13 @@ package pipeline
 
 import "context"
 
+// Payload is the data passed through a pipeline. A payload is owned by the
+// stage processing it: a processor may modify the payload it receives and
+// hand it on, but must not keep references to it, or to its slices and maps,
+// once it has returned. MarkAsProcessed is called when the payload is
+// dropped or has been consumed by the sink, after which it may be recycled.
 type Payload interface {
+	// Clone returns a deep copy sharing no mutable state with the original.
 	Clone() Payload
 	MarkAsProcessed()
 }
@@ -26,6 +32,11 @@ type StageParams interface {
 	Input() <-chan Payload
 	Output() chan<- Payload
 	Error() chan<- error
+	// DeadLetter returns the sink for failed payloads, or nil if the pipeline
+	// has none.
+	DeadLetter() Sink
+	// Observer returns the observer of the pipeline, which is never nil.
+	Observer() Observer
 }
 
 type Source interface {
@@ -0,0 +1,55 @@
+package pipeline
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LogObserver logs the work of a pipeline's stages. Failed payloads are
+// logged as warnings, finished stages at debug level and every payload at
+// trace level.
+type LogObserver struct {
+	logger *logrus.Entry
+}
+
+// NewLogObserver returns a LogObserver logging to logger, tagged with the
+// name of the pipeline.
+func NewLogObserver(logger *logrus.Entry, pipelineName string) *LogObserver {
+	return &LogObserver{logger: logger.WithField("pipeline", pipelineName)}
+}
+
+func (o *LogObserver) OnPayloadIn(stageIndex int, payload Payload) {
+	if o.logger.Logger.IsLevelEnabled(logrus.TraceLevel) {
+		o.logger.WithFields(logrus.Fields{
+			"stage":   stageIndex,
+			"payload": payload,
+		}).Trace("payload in")
+	}
+}
+
+func (o *LogObserver) OnPayloadOut(stageIndex int, payload Payload, duration time.Duration) {
+	if o.logger.Logger.IsLevelEnabled(logrus.TraceLevel) {
+		o.logger.WithFields(logrus.Fields{
+			"stage":    stageIndex,
+			"dropped":  payload == nil,
+			"duration": duration.String(),
+		}).Trace("payload out")
+	}
+}
+
+func (o *LogObserver) OnError(stageIndex int, payload Payload, err error, duration time.Duration) {
+	o.logger.WithFields(logrus.Fields{
+		"stage":    stageIndex,
+		"payload":  payload,
+		"err":      err.Error(),
+		"duration": duration.String(),
+	}).Warn("pipeline stage failed")
+}
+
+func (o *LogObserver) OnStageDone(stageIndex int, duration time.Duration) {
+	o.logger.WithFields(logrus.Fields{
+		"stage":    stageIndex,
+		"duration": duration.String(),
+	}).Debug("pipeline stage done")
+}
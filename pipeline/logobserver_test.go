@@ -0,0 +1,44 @@
+package pipeline_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/nikunicke/reaktorw/pipeline"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(LogObserverTestSuite))
+
+type LogObserverTestSuite struct{}
+
+func (s *LogObserverTestSuite) TestLogsFailuresAndStages(c *check.C) {
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	src, sink := newSourceStub(0, 10), new(sinkStub)
+	p := pipeline.New(
+		pipeline.FIFO(failing(5, time.Microsecond), pipeline.WithErrorPolicy(pipeline.SkipOnError())),
+	).WithObserver(pipeline.NewLogObserver(logrus.NewEntry(logger), "test"))
+
+	_, err := p.Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	var failed, done int
+	for _, entry := range hook.AllEntries() {
+		c.Assert(entry.Data["pipeline"], check.Equals, "test")
+		switch entry.Message {
+		case "pipeline stage failed":
+			c.Assert(entry.Level, check.Equals, logrus.WarnLevel)
+			c.Assert(entry.Data["err"], check.Matches, "failed [05]")
+			failed++
+		case "pipeline stage done":
+			c.Assert(entry.Level, check.Equals, logrus.DebugLevel)
+			done++
+		default:
+			c.Fatalf("unexpected log entry %q", entry.Message)
+		}
+	}
+	c.Assert(failed, check.Equals, 2)
+	c.Assert(done, check.Equals, 1)
+}
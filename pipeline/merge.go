@@ -0,0 +1,153 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// MergePolicy decides how payloads of several sources are merged into a
+// pipeline.
+type MergePolicy int
+
+const (
+	// InterleaveAsReady passes payloads on in the order the sources produce
+	// them, reading all sources concurrently. It is the default.
+	InterleaveAsReady MergePolicy = iota
+	// RoundRobin takes a payload from each source in turn, so a source that
+	// is slow to produce holds back the others.
+	RoundRobin
+	// Priority reads all sources concurrently but passes on the payloads of
+	// earlier sources first whenever several are ready.
+	Priority
+)
+
+// WithMergePolicy sets how payloads are merged when Process is given several
+// sources.
+func (p *Pipeline) WithMergePolicy(policy MergePolicy) *Pipeline {
+	p.mergePolicy = policy
+	return p
+}
+
+// readSources passes the payloads of sources to outCh as the merge policy
+// dictates, until all sources are exhausted or sourceCtx is cancelled.
+func (p *Pipeline) readSources(ctx, sourceCtx context.Context, sources []Source, outCh chan<- Payload, errCh chan<- error, counts *payloadCounts) {
+	switch {
+	case len(sources) == 1:
+		sourceWorker(ctx, sourceCtx, sources[0], outCh, errCh, p.observer, counts)
+	case p.mergePolicy == RoundRobin:
+		p.roundRobin(ctx, sourceCtx, sources, outCh, errCh, counts)
+	case p.mergePolicy == Priority:
+		p.priority(ctx, sourceCtx, sources, outCh, errCh, counts)
+	default:
+		var wg sync.WaitGroup
+		for _, source := range sources {
+			wg.Add(1)
+			go func(source Source) {
+				sourceWorker(ctx, sourceCtx, source, outCh, errCh, p.observer, counts)
+				wg.Done()
+			}(source)
+		}
+		wg.Wait()
+	}
+}
+
+func (p *Pipeline) roundRobin(ctx, sourceCtx context.Context, sources []Source, outCh chan<- Payload, errCh chan<- error, counts *payloadCounts) {
+	active := append([]Source(nil), sources...)
+	for len(active) > 0 {
+		for i := 0; i < len(active); {
+			source := active[i]
+			if sourceCtx.Err() != nil || !source.Next(sourceCtx) {
+				emitSourceError(source, errCh, p.observer)
+				active = append(active[:i], active[i+1:]...)
+				continue
+			}
+			payload := source.Payload()
+			atomic.AddInt64(&counts.created, 1)
+			select {
+			case outCh <- payload:
+			case <-ctx.Done():
+				abandonPayload(payload)
+				return
+			}
+			i++
+		}
+	}
+}
+
+func (p *Pipeline) priority(ctx, sourceCtx context.Context, sources []Source, outCh chan<- Payload, errCh chan<- error, counts *payloadCounts) {
+	// Each source is read ahead by a payload. ready holds a token for every
+	// payload read ahead, so there is always one to take for a token.
+	readCh := make([]chan Payload, len(sources))
+	ready := make(chan struct{}, len(sources))
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		readCh[i] = make(chan Payload, 1)
+		wg.Add(1)
+		go func(source Source, ch chan<- Payload) {
+			defer wg.Done()
+			defer close(ch)
+			for sourceCtx.Err() == nil && source.Next(sourceCtx) {
+				payload := source.Payload()
+				atomic.AddInt64(&counts.created, 1)
+				select {
+				case ch <- payload:
+					ready <- struct{}{}
+				case <-ctx.Done():
+					abandonPayload(payload)
+					return
+				}
+			}
+			emitSourceError(source, errCh, p.observer)
+		}(source, readCh[i])
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	defer func() {
+		<-done
+		for _, ch := range readCh {
+			for payload := range ch {
+				abandonPayload(payload)
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return
+		case <-done:
+			select {
+			case <-ready:
+			default:
+				return
+			}
+		}
+		payload := nextByPriority(readCh)
+		select {
+		case outCh <- payload:
+		case <-ctx.Done():
+			abandonPayload(payload)
+			return
+		}
+	}
+}
+
+// nextByPriority takes the payload read ahead from the earliest source that
+// has one.
+func nextByPriority(readCh []chan Payload) Payload {
+	for _, ch := range readCh {
+		select {
+		case payload, ok := <-ch:
+			if ok {
+				return payload
+			}
+		default:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package pipeline_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/nikunicke/reaktorw/pipeline"
+	"golang.org/x/xerrors"
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(MergeTestSuite))
+
+type MergeTestSuite struct{}
+
+var mergePolicies = []pipeline.MergePolicy{pipeline.InterleaveAsReady, pipeline.RoundRobin, pipeline.Priority}
+
+// slowSink is a sink taking delay to consume each payload.
+type slowSink struct {
+	sinkStub
+	delay time.Duration
+}
+
+func (s *slowSink) Consume(ctx context.Context, p pipeline.Payload) error {
+	time.Sleep(s.delay)
+	return s.sinkStub.Consume(ctx, p)
+}
+
+func (s *MergeTestSuite) TestReadsAllSources(c *check.C) {
+	for _, policy := range mergePolicies {
+		srcs := []*sourceStub{newSourceStub(0, 30), newSourceStub(100, 110), newSourceStub(200, 250)}
+		sink := new(sinkStub)
+		p := pipeline.New(pipeline.FIFO(identity())).WithMergePolicy(policy)
+
+		res, err := p.Process(context.TODO(), sink, srcs[0], srcs[1], srcs[2])
+		c.Assert(err, check.IsNil)
+		expected := append(append(sequence(0, 30, nil), sequence(100, 110, nil)...), sequence(200, 250, nil)...)
+		c.Assert(sorted(sink.values()), check.DeepEquals, expected, check.Commentf("policy %d", policy))
+		c.Assert(res, check.Equals, pipeline.Result{Completed: 90})
+		for _, src := range srcs {
+			assertReleasedOnce(c, src.emitted())
+		}
+	}
+}
+
+func (s *MergeTestSuite) TestRoundRobinTakesTurns(c *check.C) {
+	srcs := []*sourceStub{newSourceStub(0, 4), newSourceStub(100, 106), newSourceStub(200, 203)}
+	sink := new(sinkStub)
+	p := pipeline.New(pipeline.FIFO(identity())).WithMergePolicy(pipeline.RoundRobin)
+
+	_, err := p.Process(context.TODO(), sink, srcs[0], srcs[1], srcs[2])
+	c.Assert(err, check.IsNil)
+	c.Assert(sink.values(), check.DeepEquals, []int{0, 100, 200, 1, 101, 201, 2, 102, 202, 3, 103, 104, 105})
+}
+
+func (s *MergeTestSuite) TestPriorityPrefersEarlierSources(c *check.C) {
+	low, high := newSourceStub(100, 130), newSourceStub(0, 30)
+	sink := &slowSink{delay: time.Millisecond}
+	p := pipeline.New(pipeline.FIFO(identity())).WithMergePolicy(pipeline.Priority)
+
+	res, err := p.Process(context.TODO(), sink, high, low)
+	c.Assert(err, check.IsNil)
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 60})
+	// A few payloads of the low priority source may pass before the
+	// pipeline backs up; after that the high priority source goes first.
+	var lowFirst int
+	for _, val := range sink.values() {
+		if val < 100 {
+			break
+		}
+		lowFirst++
+	}
+	var lowBeforeLastHigh int
+	for _, val := range sink.values() {
+		if val == 29 {
+			break
+		}
+		if val >= 100 {
+			lowBeforeLastHigh++
+		}
+	}
+	c.Assert(lowBeforeLastHigh-lowFirst <= 3, check.Equals, true, check.Commentf("%v", sink.values()))
+}
+
+func (s *MergeTestSuite) TestSourceError(c *check.C) {
+	for _, policy := range mergePolicies {
+		failed, ok := newSourceStub(0, 5), newSourceStub(100, 200)
+		failed.err = xerrors.New("source failed")
+		sink := new(sinkStub)
+		p := pipeline.New(pipeline.FIFO(identity())).WithMergePolicy(policy)
+
+		res, err := p.Process(context.TODO(), sink, failed, ok)
+		c.Assert(err, check.ErrorMatches, "(?s).*source failed.*", check.Commentf("policy %d", policy))
+		emitted := append(failed.emitted(), ok.emitted()...)
+		c.Assert(res.Completed+res.Dropped+res.InFlight, check.Equals, len(emitted))
+		assertReleasedOnce(c, emitted)
+	}
+}
+
+func (s *MergeTestSuite) TestInterleaveAsReadyFollowsProduction(c *check.C) {
+	// The sources produce a payload every 20ms and 50ms respectively.
+	fast, slow := newSourceStub(0, 4), newSourceStub(100, 102)
+	fast.delay, slow.delay = 20*time.Millisecond, 50*time.Millisecond
+	sink := new(sinkStub)
+	p := pipeline.New(pipeline.FIFO(identity())).WithMergePolicy(pipeline.InterleaveAsReady)
+
+	_, err := p.Process(context.TODO(), sink, fast, slow)
+	c.Assert(err, check.IsNil)
+	c.Assert(sink.values(), check.DeepEquals, []int{0, 1, 100, 2, 3, 101})
+}
+
+func (s *MergeTestSuite) TestPriorityOnlyStarvesWhileEarlierSourcesAreReady(c *check.C) {
+	// The high priority source is slower than the pipeline, so the low
+	// priority one fills the gaps.
+	high, low := newSourceStub(0, 5), newSourceStub(100, 110)
+	high.delay = 20 * time.Millisecond
+	sink := new(sinkStub)
+	p := pipeline.New(pipeline.FIFO(identity())).WithMergePolicy(pipeline.Priority)
+
+	res, err := p.Process(context.TODO(), sink, high, low)
+	c.Assert(err, check.IsNil)
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 15})
+	var lowBeforeHigh int
+	for _, val := range sink.values() {
+		if val < 100 {
+			break
+		}
+		lowBeforeHigh++
+	}
+	c.Assert(lowBeforeHigh, check.Equals, 10, check.Commentf("%v", sink.values()))
+}
@@ -0,0 +1,62 @@
+package pipeline
+
+import "time"
+
+// Observer is notified of the work done by the stages of a pipeline. Its
+// methods are called concurrently by the stage workers and must not block.
+type Observer interface {
+	// OnPayloadIn is called when a stage starts processing a payload.
+	OnPayloadIn(stageIndex int, payload Payload)
+	// OnPayloadOut is called when a stage has processed a payload. payload
+	// is the processor's output, nil if the payload was dropped.
+	OnPayloadOut(stageIndex int, payload Payload, duration time.Duration)
+	// OnError is called when processing failed for good, after any retries.
+	// payload is nil for errors not tied to a single payload.
+	OnError(stageIndex int, payload Payload, err error, duration time.Duration)
+	// OnStageDone is called when a stage has returned.
+	OnStageDone(stageIndex int, duration time.Duration)
+}
+
+// WithObserver attaches an observer to the pipeline.
+func (p *Pipeline) WithObserver(o Observer) *Pipeline {
+	p.observer = o
+	return p
+}
+
+type nopObserver struct{}
+
+func (nopObserver) OnPayloadIn(int, Payload)                   {}
+func (nopObserver) OnPayloadOut(int, Payload, time.Duration)   {}
+func (nopObserver) OnError(int, Payload, error, time.Duration) {}
+func (nopObserver) OnStageDone(int, time.Duration)             {}
+
+type multiObserver []Observer
+
+// MultiObserver notifies each of observers in turn.
+func MultiObserver(observers ...Observer) Observer {
+	return multiObserver(observers)
+}
+
+func (m multiObserver) OnPayloadIn(stageIndex int, payload Payload) {
+	for _, o := range m {
+		o.OnPayloadIn(stageIndex, payload)
+	}
+}
+
+func (m multiObserver) OnPayloadOut(stageIndex int, payload Payload, duration time.Duration) {
+	for _, o := range m {
+		o.OnPayloadOut(stageIndex, payload, duration)
+	}
+}
+
+func (m multiObserver) OnError(stageIndex int, payload Payload, err error, duration time.Duration) {
+	for _, o := range m {
+		o.OnError(stageIndex, payload, err, duration)
+	}
+}
+
+func (m multiObserver) OnStageDone(stageIndex int, duration time.Duration) {
+	for _, o := range m {
+		o.OnStageDone(stageIndex, duration)
+	}
+}
@@ -0,0 +1,134 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+)
+
+// reorderWindowFactor bounds the payloads an ordered worker pool holds,
+// in processing or waiting for their predecessors, to this many per worker.
+const reorderWindowFactor = 2
+
+type orderedJob struct {
+	seq     uint64
+	payload Payload
+}
+
+type orderedWorkerPool struct {
+	worker     fifo
+	numWorkers int
+}
+
+// OrderedWorkerPool processes payloads with numWorkers workers in parallel
+// but passes them on in the order they arrived. Payloads finished ahead of
+// their predecessors wait in a reorder buffer of bounded size.
+func OrderedWorkerPool(proc Processor, numWorkers uint, opts ...StageOption) StageRunner {
+	if numWorkers <= 0 {
+		panic("pipeline: OrderedWorkerPool numWorkers must be > 0")
+	}
+	return &orderedWorkerPool{
+		worker:     fifo{proc: proc, conf: newStageConfig(opts)},
+		numWorkers: int(numWorkers),
+	}
+}
+
+func (r *orderedWorkerPool) Run(ctx context.Context, params StageParams) {
+	stageCtx, cancelFn := context.WithCancel(ctx)
+	defer cancelFn()
+	windowSize := reorderWindowFactor * r.numWorkers
+	window := make(chan struct{}, windowSize)
+	jobs := make(chan orderedJob)
+	// At most windowSize jobs are in flight, so workers never block on
+	// results.
+	results := make(chan orderedJob, windowSize)
+
+	var wg sync.WaitGroup
+	for i := 0; i < r.numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				payloadOut, err := r.worker.process(stageCtx, params, job.payload)
+				switch {
+				case err != nil:
+					if !r.worker.handleError(stageCtx, params, job.payload, err) {
+						cancelFn()
+					}
+					// The failed payload has been released; only its sequence
+					// number moves on.
+					payloadOut = nil
+				case payloadOut == nil:
+					dropPayload(params, job.payload)
+				}
+				job.payload = payloadOut
+				results <- job
+			}
+		}()
+	}
+	emitDone := make(chan struct{})
+	go func() {
+		r.emit(stageCtx, params, results, window)
+		close(emitDone)
+	}()
+
+	var seq uint64
+dispatch:
+	for {
+		select {
+		case <-stageCtx.Done():
+			break dispatch
+		case payloadIn, ok := <-params.Input():
+			if !ok {
+				break dispatch
+			}
+			select {
+			case window <- struct{}{}:
+			case <-stageCtx.Done():
+				abandonPayload(payloadIn)
+				break dispatch
+			}
+			select {
+			case jobs <- orderedJob{seq: seq, payload: payloadIn}:
+				seq++
+			case <-stageCtx.Done():
+				abandonPayload(payloadIn)
+				break dispatch
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(results)
+	<-emitDone
+}
+
+// emit passes processed payloads on in sequence order, freeing a slot of the
+// window for each.
+func (r *orderedWorkerPool) emit(ctx context.Context, params StageParams, results <-chan orderedJob, window <-chan struct{}) {
+	pending := make(map[uint64]orderedJob, cap(results))
+	var next uint64
+	for job := range results {
+		pending[job.seq] = job
+		for {
+			job, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			<-window
+			if job.payload == nil {
+				continue
+			}
+			if ctx.Err() != nil {
+				abandonPayload(job.payload)
+				continue
+			}
+			select {
+			case params.Output() <- job.payload:
+			case <-ctx.Done():
+				abandonPayload(job.payload)
+			}
+		}
+	}
+}
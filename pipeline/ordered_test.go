@@ -0,0 +1,80 @@
+package pipeline_test
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/nikunicke/reaktorw/pipeline"
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(OrderedWorkerPoolTestSuite))
+
+type OrderedWorkerPoolTestSuite struct{}
+
+func (s *OrderedWorkerPoolTestSuite) TestPreservesOrder(c *check.C) {
+	src, sink := newSourceStub(0, 100), new(sinkStub)
+	proc := pipeline.ProcessorFunc(func(_ context.Context, p pipeline.Payload) (pipeline.Payload, error) {
+		time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+		return p, nil
+	})
+
+	res, err := pipeline.New(pipeline.OrderedWorkerPool(proc, 8)).Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	c.Assert(sink.values(), check.DeepEquals, sequence(0, 100, nil))
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 100})
+	assertReleasedOnce(c, src.emitted())
+}
+
+func (s *OrderedWorkerPoolTestSuite) TestSkipOnErrorDropsFailedPayloads(c *check.C) {
+	src, sink, dl := newSourceStub(0, 50), new(sinkStub), new(deadLetterStub)
+	p := pipeline.New(
+		pipeline.OrderedWorkerPool(failing(7, 100*time.Microsecond), 4, pipeline.WithErrorPolicy(pipeline.SkipOnError())),
+	).WithDeadLetter(dl)
+
+	res, err := p.Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	isFailed := func(i int) bool { return i%7 == 0 }
+	c.Assert(sink.values(), check.DeepEquals, sequence(0, 50, isFailed))
+	c.Assert(dl.values(), check.HasLen, 8)
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 42, Dropped: 8})
+	assertReleasedOnce(c, src.emitted())
+}
+
+func (s *OrderedWorkerPoolTestSuite) TestHoldsBackPayloadsOvertakingTheirPredecessor(c *check.C) {
+	// The first payload only finishes once its successors have, and while it
+	// is held up no more than the reorder window of payloads are processed.
+	var finished int32
+	release := make(chan struct{})
+	proc := pipeline.ProcessorFunc(func(_ context.Context, p pipeline.Payload) (pipeline.Payload, error) {
+		if p.(*testPayload).val == 0 {
+			<-release
+		} else {
+			atomic.AddInt32(&finished, 1)
+		}
+		return p, nil
+	})
+	src, sink := newSourceStub(0, 50), new(sinkStub)
+	done := make(chan pipeline.Result)
+	go func() {
+		res, err := pipeline.New(pipeline.OrderedWorkerPool(proc, 4)).Process(context.TODO(), sink, src)
+		c.Check(err, check.IsNil)
+		done <- res
+	}()
+
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&finished) < 3; {
+		c.Assert(time.Now().Before(deadline), check.Equals, true, check.Commentf("successors of the first payload not processed"))
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	c.Assert(sink.values(), check.HasLen, 0)
+	n := atomic.LoadInt32(&finished)
+	c.Assert(n < 8, check.Equals, true, check.Commentf("%d payloads processed", n))
+	close(release)
+
+	c.Assert(<-done, check.Equals, pipeline.Result{Completed: 50})
+	c.Assert(sink.values(), check.DeepEquals, sequence(0, 50, nil))
+	assertReleasedOnce(c, src.emitted())
+}
@@ -3,8 +3,10 @@ package pipeline
 import (
 	"context"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"golang.org/x/xerrors"
+	"github.com/hashicorp/go-multierror"
 )
 
 var _ StageParams = (*workerParams)(nil)
@@ -12,60 +14,120 @@ var _ StageParams = (*workerParams)(nil)
 type workerParams struct {
 	stage int
 
-	inCh  <-chan Payload
-	outCh chan<- Payload
-	errCh chan<- error
+	inCh       <-chan Payload
+	outCh      chan<- Payload
+	errCh      chan<- error
+	deadLetter Sink
+	observer   Observer
+	counts     *payloadCounts
 }
 
 func (p *workerParams) StageIndex() int        { return p.stage }
 func (p *workerParams) Input() <-chan Payload  { return p.inCh }
 func (p *workerParams) Output() chan<- Payload { return p.outCh }
 func (p *workerParams) Error() chan<- error    { return p.errCh }
+func (p *workerParams) DeadLetter() Sink       { return p.deadLetter }
+func (p *workerParams) Observer() Observer     { return p.observer }
 
 type Pipeline struct {
-	stages []StageRunner
+	stages     []StageRunner
+	deadLetter Sink
+	observer   Observer
+
+	queues        map[int]QueueConfig
+	defaultQueue  QueueConfig
+	queueObserver QueueObserver
+
+	drain        bool
+	drainTimeout time.Duration
+	mergePolicy  MergePolicy
 }
 
 func New(stages ...StageRunner) *Pipeline {
-	return &Pipeline{stages: stages}
+	return &Pipeline{stages: stages, observer: nopObserver{}}
 }
 
-// Process
-func (p *Pipeline) Process(ctx context.Context, source Source, sink Sink) error {
+// WithDeadLetter sets the sink receiving a *DeadLetter for every payload a
+// stage failed to process. Calls to the sink are serialized.
+func (p *Pipeline) WithDeadLetter(sink Sink) *Pipeline {
+	p.deadLetter = &lockedSink{sink: sink}
+	return p
+}
+
+// Process reads payloads from sources, merged as set with WithMergePolicy,
+// passes them through the stages and hands them to sink. It returns the
+// payload counts and all errors, aggregated in a *multierror.Error of
+// *StageError values. Cancelling ctx is not an error.
+func (p *Pipeline) Process(ctx context.Context, sink Sink, sources ...Source) (Result, error) {
 	var wg sync.WaitGroup
-	pCtx, cancelFn := context.WithCancel(ctx)
+	pCtx, cancelFn := p.stageContext(ctx)
 	defer cancelFn()
+	// The sources stop as soon as ctx is cancelled, even in drain mode.
+	sourceCtx, cancelSource := context.WithCancel(pCtx)
+	defer cancelSource()
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancelSource()
+		case <-sourceCtx.Done():
+		}
+	}()
+	counts := new(payloadCounts)
 
+	// Stage i reads from stageCh[i], which is fed through writeCh[i].
 	stageCh := make([]chan Payload, len(p.stages)+1)
+	writeCh := make([]chan Payload, len(p.stages)+1)
 	errCh := make(chan error, len(p.stages)+2)
 	for i := 0; i < len(p.stages)+1; i++ {
-		stageCh[i] = make(chan Payload)
+		var forward bool
+		writeCh[i], stageCh[i], forward = p.newQueue(i)
+		if forward {
+			wg.Add(1)
+			go func(stageIndex int) {
+				p.forward(pCtx, stageIndex, writeCh[stageIndex], stageCh[stageIndex], counts)
+				wg.Done()
+			}(i)
+		}
 	}
 	for i := 0; i < len(p.stages); i++ {
 		wg.Add(1)
 		go func(stageIndex int) {
+			startAt := time.Now()
 			p.stages[stageIndex].Run(pCtx, &workerParams{
 				stage: stageIndex,
 				inCh:  stageCh[stageIndex],
-				outCh: stageCh[stageIndex+1],
+				outCh: writeCh[stageIndex+1],
 				errCh: errCh,
+
+				deadLetter: p.deadLetter,
+				observer:   p.observer,
+				counts:     counts,
 			})
-			close(stageCh[stageIndex+1])
+			p.observer.OnStageDone(stageIndex, time.Since(startAt))
+			close(writeCh[stageIndex+1])
 			wg.Done()
 		}(i)
 	}
 	wg.Add(2)
 	go func() {
-		sourceWorker(pCtx, source, stageCh[0], errCh)
-		close(stageCh[0])
+		p.readSources(pCtx, sourceCtx, sources, writeCh[0], errCh, counts)
+		close(writeCh[0])
 		wg.Done()
 	}()
 	go func() {
-		sinkWorker(pCtx, sink, stageCh[len(stageCh)-1], errCh)
+		sinkWorker(pCtx, sink, stageCh[len(stageCh)-1], errCh, p.observer, counts)
 		wg.Done()
 	}()
 	go func() {
 		wg.Wait()
+		// Payloads still queued once every worker has returned are left in
+		// flight.
+		for i, ch := range stageCh {
+			for payload := range ch {
+				abandonPayload(payload)
+			}
+			p.observeQueue(i, 0, false)
+		}
 		close(errCh)
 		cancelFn()
 	}()
@@ -73,30 +135,38 @@ func (p *Pipeline) Process(ctx context.Context, source Source, sink Sink) error
 	var errAll error
 
 	for err := range errCh {
-		// errAll = multierror.Append(errAll, err)
-		errAll = err
+		errAll = multierror.Append(errAll, err)
 		cancelFn()
 	}
-	return errAll
+	return counts.result(), errAll
 }
 
-// sourceWorker
-func sourceWorker(ctx context.Context, source Source, outCh chan<- Payload, errCh chan<- error) {
-	for source.Next(ctx) {
+// sourceWorker reads payloads from source until it is exhausted or sourceCtx
+// is cancelled, which is checked before every payload as sources need not
+// honour the context. Payloads read are passed on unless ctx is cancelled.
+func sourceWorker(ctx, sourceCtx context.Context, source Source, outCh chan<- Payload, errCh chan<- error, observer Observer, counts *payloadCounts) {
+	for sourceCtx.Err() == nil && source.Next(sourceCtx) {
 		payload := source.Payload()
+		atomic.AddInt64(&counts.created, 1)
 		select {
 		case outCh <- payload:
 		case <-ctx.Done():
+			abandonPayload(payload)
 			return
 		}
 	}
+	emitSourceError(source, errCh, observer)
+}
+
+// emitSourceError reports the error of an exhausted source, if any.
+func emitSourceError(source Source, errCh chan<- error, observer Observer) {
 	if err := source.Error(); err != nil {
-		newErr := xerrors.New("source error")
-		maybeEmitError(newErr, errCh)
+		observer.OnError(SourceStage, nil, err, 0)
+		emitError(newStageError(SourceStage, nil, err), errCh)
 	}
 }
 
-func sinkWorker(ctx context.Context, sink Sink, inCh <-chan Payload, errCh chan<- error) {
+func sinkWorker(ctx context.Context, sink Sink, inCh <-chan Payload, errCh chan<- error, observer Observer, counts *payloadCounts) {
 	for {
 		select {
 		case <-ctx.Done():
@@ -105,19 +175,32 @@ func sinkWorker(ctx context.Context, sink Sink, inCh <-chan Payload, errCh chan<
 			if !ok {
 				return
 			}
+			startAt := time.Now()
 			if err := sink.Consume(ctx, payload); err != nil {
-				newErr := xerrors.New("sink error")
-				maybeEmitError(newErr, errCh)
+				observer.OnError(SinkStage, payload, err, time.Since(startAt))
+				emitError(newStageError(SinkStage, payload, err), errCh)
+				abandonPayload(payload)
 				return
 			}
+			atomic.AddInt64(&counts.completed, 1)
 			payload.MarkAsProcessed()
 		}
 	}
 }
 
-func maybeEmitError(err error, errCh chan<- error) {
-	select {
-	case errCh <- err:
-	default:
-	}
+// emitError reports err to Process, which keeps reading errors until all
+// stages have returned.
+func emitError(err error, errCh chan<- error) {
+	errCh <- err
+}
+
+type lockedSink struct {
+	mu   sync.Mutex
+	sink Sink
+}
+
+func (s *lockedSink) Consume(ctx context.Context, p Payload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sink.Consume(ctx, p)
 }
@@ -0,0 +1,145 @@
+package pipeline_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nikunicke/reaktorw/pipeline"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type testPayload struct {
+	val       int
+	processed int32
+}
+
+func (p *testPayload) Clone() pipeline.Payload { return &testPayload{val: p.val} }
+func (p *testPayload) MarkAsProcessed()        { atomic.AddInt32(&p.processed, 1) }
+func (p *testPayload) String() string          { return fmt.Sprint(p.val) }
+
+// sourceStub emits a payload for each of its values. Next honours ctx and
+// sleeps for delay before each payload.
+type sourceStub struct {
+	mu       sync.Mutex
+	index    int
+	delay    time.Duration
+	payloads []*testPayload
+	err      error
+}
+
+func newSourceStub(from, to int) *sourceStub {
+	s := new(sourceStub)
+	for i := from; i < to; i++ {
+		s.payloads = append(s.payloads, &testPayload{val: i})
+	}
+	return s
+}
+
+func (s *sourceStub) Next(ctx context.Context) bool {
+	if s.delay > 0 {
+		time.Sleep(s.delay)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ctx.Err() != nil || s.index >= len(s.payloads) {
+		return false
+	}
+	s.index++
+	return true
+}
+func (s *sourceStub) Payload() pipeline.Payload { return s.payloads[s.index-1] }
+func (s *sourceStub) Error() error              { return s.err }
+
+// emitted returns the payloads the source has handed out.
+func (s *sourceStub) emitted() []*testPayload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.payloads[:s.index]
+}
+
+type sinkStub struct {
+	mu   sync.Mutex
+	data []int
+	err  error
+}
+
+func (s *sinkStub) Consume(_ context.Context, p pipeline.Payload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.data = append(s.data, p.(*testPayload).val)
+	return nil
+}
+
+func (s *sinkStub) values() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.data...)
+}
+
+type deadLetterStub struct {
+	mu   sync.Mutex
+	data []int
+}
+
+func (s *deadLetterStub) Consume(_ context.Context, p pipeline.Payload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dl := p.(*pipeline.DeadLetter)
+	if payload, ok := dl.Payload.(*testPayload); ok {
+		s.data = append(s.data, payload.val)
+	}
+	return nil
+}
+
+func (s *deadLetterStub) values() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.data...)
+}
+
+// assertReleasedOnce checks that every payload has been marked as processed
+// exactly once.
+func assertReleasedOnce(c *check.C, payloads []*testPayload) {
+	for _, p := range payloads {
+		c.Assert(atomic.LoadInt32(&p.processed), check.Equals, int32(1), check.Commentf("payload %d", p.val))
+	}
+}
+
+// failing returns a processor failing, with its payload still returned, for
+// values divisible by n.
+func failing(n int, delay time.Duration) pipeline.Processor {
+	return pipeline.ProcessorFunc(func(_ context.Context, p pipeline.Payload) (pipeline.Payload, error) {
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+		if p.(*testPayload).val%n == 0 {
+			return p, fmt.Errorf("failed %d", p.(*testPayload).val)
+		}
+		return p, nil
+	})
+}
+
+func identity() pipeline.Processor {
+	return pipeline.ProcessorFunc(func(_ context.Context, p pipeline.Payload) (pipeline.Payload, error) {
+		return p, nil
+	})
+}
+
+func sequence(from, to int, skip func(int) bool) []int {
+	var vals []int
+	for i := from; i < to; i++ {
+		if skip == nil || !skip(i) {
+			vals = append(vals, i)
+		}
+	}
+	return vals
+}
@@ -0,0 +1,105 @@
+package pipeline
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// QueueConfig configures the queue feeding a stage.
+type QueueConfig struct {
+	// Size is the number of payloads buffered for the stage. Zero means
+	// unbuffered.
+	Size int
+	// DropWhenFull drops payloads, marking them as processed, instead of
+	// blocking the previous stage while the queue is full.
+	DropWhenFull bool
+}
+
+// QueueObserver is called whenever a payload is queued for a stage, with the
+// depth of the queue afterwards. dropped is set if the payload was dropped
+// because the queue was full. Depths are not sampled as stages dequeue
+// payloads, but every queue is reported with depth 0 once Process returns.
+// The sink's queue has index len(stages). The observer is called
+// concurrently for different stages.
+type QueueObserver func(stageIndex, depth int, dropped bool)
+
+// WithQueue configures the queue feeding the stage at stageIndex. The sink's
+// queue has index len(stages).
+func (p *Pipeline) WithQueue(stageIndex int, conf QueueConfig) *Pipeline {
+	if p.queues == nil {
+		p.queues = make(map[int]QueueConfig)
+	}
+	p.queues[stageIndex] = conf
+	return p
+}
+
+// WithQueues configures the queues of all stages and the sink that are not
+// configured with WithQueue.
+func (p *Pipeline) WithQueues(conf QueueConfig) *Pipeline {
+	p.defaultQueue = conf
+	return p
+}
+
+// ObserveQueues sets an observer of the queue depths. Like DropWhenFull, it
+// makes each queue fed by a goroutine of its own, which holds one payload in
+// addition to the queue's Size while the queue is full.
+func (p *Pipeline) ObserveQueues(o QueueObserver) *Pipeline {
+	p.queueObserver = o
+	return p
+}
+
+func (p *Pipeline) queue(stageIndex int) QueueConfig {
+	if conf, ok := p.queues[stageIndex]; ok {
+		return conf
+	}
+	return p.defaultQueue
+}
+
+// newQueue returns the channel writers send payloads for the stage at
+// stageIndex to, and the channel the stage reads from. If the two differ,
+// forward must be run to move payloads from one to the other.
+func (p *Pipeline) newQueue(stageIndex int) (chan Payload, chan Payload, bool) {
+	conf := p.queue(stageIndex)
+	size := conf.Size
+	if size < 0 {
+		size = 0
+	}
+	readCh := make(chan Payload, size)
+	if !conf.DropWhenFull && p.queueObserver == nil {
+		return readCh, readCh, false
+	}
+	return make(chan Payload), readCh, true
+}
+
+// forward moves payloads from writeCh to readCh, dropping or blocking when
+// readCh is full, until writeCh is closed.
+func (p *Pipeline) forward(ctx context.Context, stageIndex int, writeCh <-chan Payload, readCh chan<- Payload, counts *payloadCounts) {
+	defer close(readCh)
+	drop := p.queue(stageIndex).DropWhenFull
+	for payload := range writeCh {
+		if drop {
+			select {
+			case readCh <- payload:
+				p.observeQueue(stageIndex, len(readCh), false)
+			default:
+				payload.MarkAsProcessed()
+				atomic.AddInt64(&counts.dropped, 1)
+				p.observeQueue(stageIndex, len(readCh), true)
+			}
+			continue
+		}
+		select {
+		case readCh <- payload:
+			p.observeQueue(stageIndex, len(readCh), false)
+		case <-ctx.Done():
+			// Keep draining writeCh until the writers have returned.
+			abandonPayload(payload)
+		}
+	}
+}
+
+func (p *Pipeline) observeQueue(stageIndex, depth int, dropped bool) {
+	if p.queueObserver != nil {
+		p.queueObserver(stageIndex, depth, dropped)
+	}
+}
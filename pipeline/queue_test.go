@@ -0,0 +1,128 @@
+package pipeline_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nikunicke/reaktorw/pipeline"
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(QueueTestSuite))
+
+type QueueTestSuite struct{}
+
+// depthRecorder is a QueueObserver keeping the last depth of every queue.
+type depthRecorder struct {
+	mu      sync.Mutex
+	depths  map[int]int
+	max     int
+	dropped int
+}
+
+func (r *depthRecorder) observe(stageIndex, depth int, dropped bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.depths == nil {
+		r.depths = make(map[int]int)
+	}
+	r.depths[stageIndex] = depth
+	if depth > r.max {
+		r.max = depth
+	}
+	if dropped {
+		r.dropped++
+	}
+}
+
+func (r *depthRecorder) droppedSoFar() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dropped
+}
+
+func (s *QueueTestSuite) TestDepthsResetAfterRun(c *check.C) {
+	slow := pipeline.ProcessorFunc(func(_ context.Context, p pipeline.Payload) (pipeline.Payload, error) {
+		time.Sleep(100 * time.Microsecond)
+		return p, nil
+	})
+	src, sink, depths := newSourceStub(0, 100), new(sinkStub), new(depthRecorder)
+	p := pipeline.New(
+		pipeline.FIFO(identity()),
+		pipeline.FIFO(slow),
+	).WithQueues(pipeline.QueueConfig{Size: 5}).ObserveQueues(depths.observe)
+
+	res, err := p.Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 100})
+	c.Assert(depths.max > 0 && depths.max <= 5, check.Equals, true)
+	c.Assert(depths.depths, check.DeepEquals, map[int]int{0: 0, 1: 0, 2: 0})
+}
+
+func (s *QueueTestSuite) TestDropWhenFull(c *check.C) {
+	slow := pipeline.ProcessorFunc(func(_ context.Context, p pipeline.Payload) (pipeline.Payload, error) {
+		time.Sleep(time.Millisecond)
+		return p, nil
+	})
+	src, sink, depths := newSourceStub(0, 100), new(sinkStub), new(depthRecorder)
+	p := pipeline.New(pipeline.FIFO(slow)).
+		WithQueue(0, pipeline.QueueConfig{Size: 2, DropWhenFull: true}).
+		ObserveQueues(depths.observe)
+
+	res, err := p.Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	c.Assert(res.Dropped > 0, check.Equals, true)
+	c.Assert(res.Dropped, check.Equals, depths.dropped)
+	c.Assert(res.Completed+res.Dropped, check.Equals, 100)
+	c.Assert(depths.depths[0], check.Equals, 0)
+	assertReleasedOnce(c, src.emitted())
+}
+
+// gatedSource holds back all but its first payload until gate is closed.
+type gatedSource struct {
+	*sourceStub
+	gate chan struct{}
+}
+
+func (s *gatedSource) Next(ctx context.Context) bool {
+	if len(s.emitted()) == 1 {
+		<-s.gate
+	}
+	return s.sourceStub.Next(ctx)
+}
+
+func (s *QueueTestSuite) TestDropWhenFullCounts(c *check.C) {
+	src := &gatedSource{sourceStub: newSourceStub(0, 10), gate: make(chan struct{})}
+	release := make(chan struct{})
+	// The stage holds on to the first payload, so once the gate opens the
+	// queue fills up with the next two and the rest are dropped.
+	proc := pipeline.ProcessorFunc(func(_ context.Context, p pipeline.Payload) (pipeline.Payload, error) {
+		if p.(*testPayload).val == 0 {
+			close(src.gate)
+			<-release
+		}
+		return p, nil
+	})
+	sink, depths := new(sinkStub), new(depthRecorder)
+	p := pipeline.New(pipeline.FIFO(proc)).
+		WithQueue(0, pipeline.QueueConfig{Size: 2, DropWhenFull: true}).
+		ObserveQueues(depths.observe)
+	done := make(chan pipeline.Result)
+	go func() {
+		res, err := p.Process(context.TODO(), sink, src)
+		c.Check(err, check.IsNil)
+		done <- res
+	}()
+
+	for deadline := time.Now().Add(time.Second); depths.droppedSoFar() < 7; {
+		c.Assert(time.Now().Before(deadline), check.Equals, true)
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	c.Assert(<-done, check.Equals, pipeline.Result{Completed: 3, Dropped: 7})
+	c.Assert(sink.values(), check.DeepEquals, []int{0, 1, 2})
+	c.Assert(depths.dropped, check.Equals, 7)
+	c.Assert(depths.max, check.Equals, 2)
+	assertReleasedOnce(c, src.emitted())
+}
@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+)
+
+type rateLimited struct {
+	runner   StageRunner
+	interval time.Duration
+}
+
+// RateLimited wraps runner so that it receives at most rps payloads per
+// second. Payloads are passed on one at a time, without bursts, which keeps
+// stages calling out to rate limited services within their limits.
+func RateLimited(runner StageRunner, rps float64) StageRunner {
+	if rps <= 0 {
+		panic("pipeline: RateLimited rps must be > 0")
+	}
+	return &rateLimited{runner: runner, interval: time.Duration(float64(time.Second) / rps)}
+}
+
+func (r *rateLimited) Run(ctx context.Context, params StageParams) {
+	stageCtx, cancelFn := context.WithCancel(ctx)
+	defer cancelFn()
+	inCh := make(chan Payload)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.runner.Run(stageCtx, &workerParams{
+			stage: params.StageIndex(),
+			inCh:  inCh,
+			outCh: params.Output(),
+			errCh: params.Error(),
+
+			deadLetter: params.DeadLetter(),
+			observer:   params.Observer(),
+			counts:     counts(params),
+		})
+		cancelFn()
+	}()
+
+	var lastAt time.Time
+loop:
+	for {
+		select {
+		case <-stageCtx.Done():
+			break loop
+		case payload, ok := <-params.Input():
+			if !ok {
+				break loop
+			}
+			if wait := r.interval - time.Since(lastAt); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-stageCtx.Done():
+					timer.Stop()
+					abandonPayload(payload)
+					break loop
+				}
+			}
+			select {
+			case inCh <- payload:
+				lastAt = time.Now()
+			case <-stageCtx.Done():
+				abandonPayload(payload)
+				break loop
+			}
+		}
+	}
+	close(inCh)
+	<-done
+}
@@ -0,0 +1,81 @@
+package pipeline_test
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nikunicke/reaktorw/pipeline"
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(RateLimitedTestSuite))
+
+type RateLimitedTestSuite struct{}
+
+func (s *RateLimitedTestSuite) TestLimitsRate(c *check.C) {
+	src, sink := newSourceStub(0, 11), new(sinkStub)
+	startAt := time.Now()
+
+	res, err := pipeline.New(pipeline.RateLimited(pipeline.FIFO(identity()), 200)).Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	// 11 payloads take at least 10 intervals of 5ms.
+	c.Assert(time.Since(startAt) >= 50*time.Millisecond, check.Equals, true)
+	c.Assert(sink.values(), check.DeepEquals, sequence(0, 11, nil))
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 11})
+	assertReleasedOnce(c, src.emitted())
+}
+
+func (s *RateLimitedTestSuite) TestKeepsErrorPolicy(c *check.C) {
+	src, sink, dl := newSourceStub(0, 20), new(sinkStub), new(deadLetterStub)
+	p := pipeline.New(
+		pipeline.RateLimited(pipeline.FixedWorkerPool(failing(4, 0), 2, pipeline.WithErrorPolicy(pipeline.SkipOnError())), 1000),
+	).WithDeadLetter(dl)
+
+	res, err := p.Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	c.Assert(sorted(dl.values()), check.DeepEquals, []int{0, 4, 8, 12, 16})
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 15, Dropped: 5})
+	assertReleasedOnce(c, src.emitted())
+}
+
+func (s *RateLimitedTestSuite) TestSpacesPayloadsEvenly(c *check.C) {
+	var (
+		mu    sync.Mutex
+		times []time.Time
+	)
+	proc := pipeline.ProcessorFunc(func(_ context.Context, p pipeline.Payload) (pipeline.Payload, error) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		return p, nil
+	})
+	src, sink := newSourceStub(0, 10), new(sinkStub)
+
+	// Idle workers would take payloads as fast as they arrive.
+	res, err := pipeline.New(pipeline.RateLimited(pipeline.FixedWorkerPool(proc, 4), 100)).Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 10})
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	for i := 1; i < len(times); i++ {
+		// Allow for the workers being scheduled late.
+		gap := times[i].Sub(times[i-1])
+		c.Assert(gap > 5*time.Millisecond, check.Equals, true, check.Commentf("%v between payloads %d and %d", gap, i-1, i))
+	}
+	c.Assert(times[len(times)-1].Sub(times[0]) >= 85*time.Millisecond, check.Equals, true)
+}
+
+func (s *RateLimitedTestSuite) TestCancelWhileWaiting(c *check.C) {
+	ctx, cancelFn := context.WithCancel(context.Background())
+	src, sink := newSourceStub(0, 1000), new(sinkStub)
+	p := pipeline.New(pipeline.RateLimited(pipeline.FIFO(cancelAfter(2, cancelFn)), 5))
+	startAt := time.Now()
+
+	res, err := p.Process(ctx, sink, src)
+	c.Assert(err, check.IsNil)
+	// The cancellation interrupts the wait for the third payload.
+	c.Assert(time.Since(startAt) < 400*time.Millisecond, check.Equals, true)
+	c.Assert(res.Completed+res.InFlight, check.Equals, len(src.emitted()))
+	assertReleasedOnce(c, src.emitted())
+}
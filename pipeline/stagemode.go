@@ -3,16 +3,18 @@ package pipeline
 import (
 	"context"
 	"sync"
+	"time"
 
 	"golang.org/x/xerrors"
 )
 
 type fifo struct {
 	proc Processor
+	conf stageConfig
 }
 
-func FIFO(proc Processor) StageRunner {
-	return fifo{proc: proc}
+func FIFO(proc Processor, opts ...StageOption) StageRunner {
+	return fifo{proc: proc, conf: newStageConfig(opts)}
 }
 
 func (r fifo) Run(ctx context.Context, params StageParams) {
@@ -24,36 +26,89 @@ func (r fifo) Run(ctx context.Context, params StageParams) {
 			if !ok {
 				return
 			}
-			payloadOut, err := r.proc.Process(ctx, payloadIn)
-			if err != nil {
-				newErr := xerrors.New("pipeline error")
-				maybeEmitError(newErr, params.Error())
-				return
-			}
-			if payloadOut == nil {
-				payloadIn.MarkAsProcessed()
-				continue
-			}
-			select {
-			case params.Output() <- payloadOut:
-			case <-ctx.Done():
+			if !r.handle(ctx, params, payloadIn) {
 				return
 			}
 		}
 	}
 }
 
+// handle processes a single payload and passes the result on. It reports
+// whether the stage may continue.
+func (r fifo) handle(ctx context.Context, params StageParams, payloadIn Payload) bool {
+	payloadOut, err := r.process(ctx, params, payloadIn)
+	if err != nil {
+		return r.handleError(ctx, params, payloadIn, err)
+	}
+	if payloadOut == nil {
+		dropPayload(params, payloadIn)
+		return true
+	}
+	select {
+	case params.Output() <- payloadOut:
+		return true
+	case <-ctx.Done():
+		abandonPayload(payloadOut)
+		return false
+	}
+}
+
+// process runs the processor, retrying as allowed by the error policy, and
+// notifies the observer.
+func (r fifo) process(ctx context.Context, params StageParams, payload Payload) (Payload, error) {
+	params.Observer().OnPayloadIn(params.StageIndex(), payload)
+	startAt := time.Now()
+	payloadOut, err := r.proc.Process(ctx, payload)
+	err = r.conf.policy.retry(ctx, err, func() (err error) {
+		payloadOut, err = r.proc.Process(ctx, payload)
+		return err
+	})
+	if err != nil {
+		params.Observer().OnError(params.StageIndex(), payload, err, time.Since(startAt))
+	} else {
+		params.Observer().OnPayloadOut(params.StageIndex(), payloadOut, time.Since(startAt))
+	}
+	return payloadOut, err
+}
+
+// handleError dead-letters a payload the processor failed on and reports
+// whether the error policy lets the stage continue.
+func (r fifo) handleError(ctx context.Context, params StageParams, payload Payload, err error) bool {
+	stageErr := newStageError(params.StageIndex(), payload, err)
+	if !deadLetterPayload(ctx, params, payload, err) {
+		return false
+	}
+	if !r.conf.policy.skip {
+		emitError(stageErr, params.Error())
+		return false
+	}
+	return true
+}
+
+// deadLetterPayload sends a failed payload to the dead-letter sink, if there
+// is one, and marks it as processed. It reports false if the sink failed.
+func deadLetterPayload(ctx context.Context, params StageParams, payload Payload, err error) bool {
+	if deadLetter := params.DeadLetter(); deadLetter != nil {
+		if dlErr := deadLetter.Consume(ctx, &DeadLetter{Payload: payload, StageIndex: params.StageIndex(), Err: err}); dlErr != nil {
+			emitError(newStageError(params.StageIndex(), payload, xerrors.Errorf("dead-letter %v: %w", err, dlErr)), params.Error())
+			return false
+		}
+	}
+	dropPayload(params, payload)
+	return true
+}
+
 type fixedWorkerPool struct {
 	fifos []StageRunner
 }
 
-func FixedWorkerPool(proc Processor, numWorkers uint) StageRunner {
+func FixedWorkerPool(proc Processor, numWorkers uint, opts ...StageOption) StageRunner {
 	if numWorkers <= 0 {
 		panic("pipeline: FixedWorkerPool numWorkers must be > 0")
 	}
 	fifos := make([]StageRunner, int(numWorkers))
 	for i := 0; i < int(numWorkers); i++ {
-		fifos[i] = FIFO(proc)
+		fifos[i] = FIFO(proc, opts...)
 	}
 	return &fixedWorkerPool{fifos: fifos}
 }
@@ -70,3 +125,133 @@ func (r *fixedWorkerPool) Run(ctx context.Context, params StageParams) {
 	}
 	wg.Wait()
 }
+
+type dynamicWorkerPool struct {
+	worker     fifo
+	maxWorkers int
+}
+
+// DynamicWorkerPool processes each payload in its own goroutine, running at
+// most maxWorkers at a time. Workers are only started on demand, which suits
+// I/O bound stages.
+func DynamicWorkerPool(proc Processor, maxWorkers uint, opts ...StageOption) StageRunner {
+	if maxWorkers <= 0 {
+		panic("pipeline: DynamicWorkerPool maxWorkers must be > 0")
+	}
+	return &dynamicWorkerPool{
+		worker:     fifo{proc: proc, conf: newStageConfig(opts)},
+		maxWorkers: int(maxWorkers),
+	}
+}
+
+func (r *dynamicWorkerPool) Run(ctx context.Context, params StageParams) {
+	stageCtx, cancelFn := context.WithCancel(ctx)
+	defer cancelFn()
+	tokenPool := make(chan struct{}, r.maxWorkers)
+	for i := 0; i < r.maxWorkers; i++ {
+		tokenPool <- struct{}{}
+	}
+
+loop:
+	for {
+		select {
+		case <-stageCtx.Done():
+			break loop
+		case payloadIn, ok := <-params.Input():
+			if !ok {
+				break loop
+			}
+			var token struct{}
+			select {
+			case token = <-tokenPool:
+			case <-stageCtx.Done():
+				abandonPayload(payloadIn)
+				break loop
+			}
+			go func(payloadIn Payload, token struct{}) {
+				defer func() { tokenPool <- token }()
+				if !r.worker.handle(stageCtx, params, payloadIn) {
+					cancelFn()
+				}
+			}(payloadIn, token)
+		}
+	}
+	// Wait for all workers to return their tokens.
+	for i := 0; i < r.maxWorkers; i++ {
+		<-tokenPool
+	}
+}
+
+type broadcast struct {
+	fifos []StageRunner
+}
+
+// Broadcast passes every payload to each of procs in parallel. All but the
+// first processor receive a copy made with Payload.Clone, and the outputs of
+// every processor are passed on to the next stage. Processors wrapped in
+// FIFO semantics use the default error policy.
+func Broadcast(procs ...Processor) StageRunner {
+	if len(procs) == 0 {
+		panic("pipeline: Broadcast requires at least one processor")
+	}
+	fifos := make([]StageRunner, len(procs))
+	for i, proc := range procs {
+		fifos[i] = FIFO(proc)
+	}
+	return &broadcast{fifos: fifos}
+}
+
+func (r *broadcast) Run(ctx context.Context, params StageParams) {
+	var wg sync.WaitGroup
+	inCh := make([]chan Payload, len(r.fifos))
+	for i := 0; i < len(r.fifos); i++ {
+		wg.Add(1)
+		inCh[i] = make(chan Payload)
+		go func(fifoIndex int) {
+			r.fifos[fifoIndex].Run(ctx, &workerParams{
+				stage: params.StageIndex(),
+				inCh:  inCh[fifoIndex],
+				outCh: params.Output(),
+				errCh: params.Error(),
+
+				deadLetter: params.DeadLetter(),
+				observer:   params.Observer(),
+				counts:     counts(params),
+			})
+			wg.Done()
+		}(i)
+	}
+
+done:
+	for {
+		select {
+		case <-ctx.Done():
+			break done
+		case payload, ok := <-params.Input():
+			if !ok {
+				break done
+			}
+			// The original is sent last, so it is not handed on before all
+			// copies have been made.
+			for i := len(r.fifos) - 1; i >= 0; i-- {
+				fifoPayload := payload
+				if i != 0 {
+					fifoPayload = clonePayload(params, payload)
+				}
+				select {
+				case inCh[i] <- fifoPayload:
+				case <-ctx.Done():
+					abandonPayload(fifoPayload)
+					if i != 0 {
+						abandonPayload(payload)
+					}
+					break done
+				}
+			}
+		}
+	}
+	for _, ch := range inCh {
+		close(ch)
+	}
+	wg.Wait()
+}
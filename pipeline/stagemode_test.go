@@ -0,0 +1,224 @@
+package pipeline_test
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nikunicke/reaktorw/pipeline"
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(DynamicWorkerPoolTestSuite))
+
+type DynamicWorkerPoolTestSuite struct{}
+
+// sorted returns the values in ascending order.
+func sorted(vals []int) []int {
+	sort.Ints(vals)
+	return vals
+}
+
+func (s *DynamicWorkerPoolTestSuite) TestLimitsWorkers(c *check.C) {
+	var active, maxActive int32
+	proc := pipeline.ProcessorFunc(func(_ context.Context, p pipeline.Payload) (pipeline.Payload, error) {
+		n := atomic.AddInt32(&active, 1)
+		for {
+			max := atomic.LoadInt32(&maxActive)
+			if n <= max || atomic.CompareAndSwapInt32(&maxActive, max, n) {
+				break
+			}
+		}
+		time.Sleep(200 * time.Microsecond)
+		atomic.AddInt32(&active, -1)
+		return p, nil
+	})
+	src, sink := newSourceStub(0, 100), new(sinkStub)
+
+	res, err := pipeline.New(pipeline.DynamicWorkerPool(proc, 4)).Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	c.Assert(atomic.LoadInt32(&maxActive) <= 4, check.Equals, true)
+	c.Assert(sorted(sink.values()), check.DeepEquals, sequence(0, 100, nil))
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 100})
+	assertReleasedOnce(c, src.emitted())
+}
+
+func (s *DynamicWorkerPoolTestSuite) TestSkipOnErrorDropsFailedPayloads(c *check.C) {
+	src, sink, dl := newSourceStub(0, 50), new(sinkStub), new(deadLetterStub)
+	p := pipeline.New(
+		pipeline.DynamicWorkerPool(failing(5, 100*time.Microsecond), 4, pipeline.WithErrorPolicy(pipeline.SkipOnError())),
+	).WithDeadLetter(dl)
+
+	res, err := p.Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	isFailed := func(i int) bool { return i%5 == 0 }
+	c.Assert(sorted(sink.values()), check.DeepEquals, sequence(0, 50, isFailed))
+	c.Assert(sorted(dl.values()), check.DeepEquals, sequence(0, 50, func(i int) bool { return !isFailed(i) }))
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 40, Dropped: 10})
+	assertReleasedOnce(c, src.emitted())
+}
+
+func (s *DynamicWorkerPoolTestSuite) TestRetryOnError(c *check.C) {
+	var attempts int32
+	flaky := pipeline.ProcessorFunc(func(_ context.Context, p pipeline.Payload) (pipeline.Payload, error) {
+		if p.(*testPayload).val == 3 && atomic.AddInt32(&attempts, 1) < 3 {
+			return nil, context.DeadlineExceeded
+		}
+		return p, nil
+	})
+	src, sink := newSourceStub(0, 10), new(sinkStub)
+	p := pipeline.New(
+		pipeline.DynamicWorkerPool(flaky, 4, pipeline.WithErrorPolicy(pipeline.RetryOnError(2, pipeline.FailOnError()))),
+	)
+
+	res, err := p.Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	c.Assert(atomic.LoadInt32(&attempts), check.Equals, int32(3))
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 10})
+}
+
+func (s *DynamicWorkerPoolTestSuite) TestProcessesConcurrently(c *check.C) {
+	started, release := make(chan int), make(chan struct{})
+	proc := pipeline.ProcessorFunc(func(_ context.Context, p pipeline.Payload) (pipeline.Payload, error) {
+		started <- p.(*testPayload).val
+		<-release
+		return p, nil
+	})
+	src, sink := newSourceStub(0, 8), new(sinkStub)
+	done := make(chan pipeline.Result)
+	go func() {
+		res, err := pipeline.New(pipeline.DynamicWorkerPool(proc, 4)).Process(context.TODO(), sink, src)
+		c.Check(err, check.IsNil)
+		done <- res
+	}()
+
+	// Four payloads are being processed at once, and no more.
+	var vals []int
+	for len(vals) < 4 {
+		select {
+		case val := <-started:
+			vals = append(vals, val)
+		case <-time.After(time.Second):
+			c.Fatalf("only %d payloads processed concurrently", len(vals))
+		}
+	}
+	c.Assert(sorted(vals), check.DeepEquals, sequence(0, 4, nil))
+	select {
+	case val := <-started:
+		c.Fatalf("payload %d processed by a fifth worker", val)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	for range sequence(4, 8, nil) {
+		<-started
+	}
+	c.Assert(<-done, check.Equals, pipeline.Result{Completed: 8})
+	assertReleasedOnce(c, src.emitted())
+}
+
+func (s *DynamicWorkerPoolTestSuite) TestOutputFollowsCompletionOrder(c *check.C) {
+	// The first payload is the slowest, so the others overtake it.
+	proc := pipeline.ProcessorFunc(func(_ context.Context, p pipeline.Payload) (pipeline.Payload, error) {
+		if p.(*testPayload).val == 0 {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return p, nil
+	})
+	src, sink := newSourceStub(0, 10), new(sinkStub)
+
+	res, err := pipeline.New(pipeline.DynamicWorkerPool(proc, 4)).Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	vals := sink.values()
+	c.Assert(vals[len(vals)-1], check.Equals, 0)
+	c.Assert(sorted(vals), check.DeepEquals, sequence(0, 10, nil))
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 10})
+}
+
+var _ = check.Suite(new(BroadcastTestSuite))
+
+type BroadcastTestSuite struct{}
+
+// recorder is a processor recording the payloads it sees, tagging them with
+// offset so the outputs of several recorders can be told apart.
+type recorder struct {
+	mu       sync.Mutex
+	offset   int
+	payloads []*testPayload
+}
+
+func (r *recorder) Process(_ context.Context, p pipeline.Payload) (pipeline.Payload, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	payload := p.(*testPayload)
+	r.payloads = append(r.payloads, payload)
+	payload.val += r.offset
+	return payload, nil
+}
+
+func (r *recorder) seen() []*testPayload {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*testPayload(nil), r.payloads...)
+}
+
+func (s *BroadcastTestSuite) TestEveryProcessorGetsEveryPayload(c *check.C) {
+	procs := []*recorder{{offset: 0}, {offset: 1000}, {offset: 2000}}
+	src, sink := newSourceStub(0, 50), new(sinkStub)
+
+	res, err := pipeline.New(pipeline.Broadcast(procs[0], procs[1], procs[2])).Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	var expected []int
+	for _, proc := range procs {
+		expected = append(expected, sequence(proc.offset, proc.offset+50, nil)...)
+		c.Assert(proc.seen(), check.HasLen, 50)
+		assertReleasedOnce(c, proc.seen())
+	}
+	c.Assert(sorted(sink.values()), check.DeepEquals, expected)
+	// The copies are counted as payloads of their own.
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 150})
+	// The first processor gets the originals.
+	c.Assert(procs[0].seen(), check.DeepEquals, src.emitted())
+}
+
+func (s *BroadcastTestSuite) TestDroppedCopyOnlyDropsItself(c *check.C) {
+	originals := new(recorder)
+	dropAll := pipeline.ProcessorFunc(func(context.Context, pipeline.Payload) (pipeline.Payload, error) {
+		return nil, nil
+	})
+	src, sink := newSourceStub(0, 50), new(sinkStub)
+
+	res, err := pipeline.New(pipeline.Broadcast(originals, dropAll)).Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	c.Assert(sorted(sink.values()), check.DeepEquals, sequence(0, 50, nil))
+	c.Assert(res, check.Equals, pipeline.Result{Completed: 50, Dropped: 50})
+	assertReleasedOnce(c, src.emitted())
+}
+
+func (s *BroadcastTestSuite) TestProcessorsRunInParallel(c *check.C) {
+	// Each processor waits for the other to have started on the same
+	// payload, which only completes if they run side by side.
+	var barrier sync.WaitGroup
+	barrier.Add(2)
+	waitForOther := pipeline.ProcessorFunc(func(_ context.Context, p pipeline.Payload) (pipeline.Payload, error) {
+		barrier.Done()
+		done := make(chan struct{})
+		go func() {
+			barrier.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return nil, nil
+		case <-time.After(time.Second):
+			return nil, context.DeadlineExceeded
+		}
+	})
+	src, sink := newSourceStub(0, 1), new(sinkStub)
+
+	res, err := pipeline.New(pipeline.Broadcast(waitForOther, waitForOther)).Process(context.TODO(), sink, src)
+	c.Assert(err, check.IsNil)
+	c.Assert(res, check.Equals, pipeline.Result{Dropped: 2})
+	assertReleasedOnce(c, src.emitted())
+}
@@ -0,0 +1,133 @@
+package pipeline
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds used to estimate latency percentiles,
+// doubling from a microsecond to about 70 seconds.
+var latencyBuckets = func() []time.Duration {
+	buckets := make([]time.Duration, 27)
+	for i := range buckets {
+		buckets[i] = time.Microsecond << uint(i)
+	}
+	return buckets
+}()
+
+// StageStats summarizes the work of a stage. Latency percentiles are
+// estimated with exponential buckets, so they are accurate to a factor of
+// two.
+type StageStats struct {
+	StageIndex int
+	In         int
+	Out        int
+	Dropped    int
+	Errors     int
+	// Duration is the time the stage was running.
+	Duration time.Duration
+	P50      time.Duration
+	P90      time.Duration
+	P99      time.Duration
+
+	counts []int
+}
+
+// StatsObserver is an Observer collecting per-stage counts and latencies.
+type StatsObserver struct {
+	mu     sync.Mutex
+	stages map[int]*StageStats
+}
+
+// NewStatsObserver returns an empty StatsObserver.
+func NewStatsObserver() *StatsObserver {
+	return &StatsObserver{stages: make(map[int]*StageStats)}
+}
+
+// stage must be called with the lock held.
+func (o *StatsObserver) stage(stageIndex int) *StageStats {
+	stats := o.stages[stageIndex]
+	if stats == nil {
+		stats = &StageStats{StageIndex: stageIndex, counts: make([]int, len(latencyBuckets)+1)}
+		o.stages[stageIndex] = stats
+	}
+	return stats
+}
+
+// observe must be called with the lock held.
+func (o *StatsObserver) observe(stats *StageStats, duration time.Duration) {
+	stats.counts[sort.Search(len(latencyBuckets), func(i int) bool { return latencyBuckets[i] >= duration })]++
+}
+
+func (o *StatsObserver) OnPayloadIn(stageIndex int, _ Payload) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.stage(stageIndex).In++
+}
+
+func (o *StatsObserver) OnPayloadOut(stageIndex int, payload Payload, duration time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	stats := o.stage(stageIndex)
+	if payload == nil {
+		stats.Dropped++
+	} else {
+		stats.Out++
+	}
+	o.observe(stats, duration)
+}
+
+func (o *StatsObserver) OnError(stageIndex int, _ Payload, _ error, duration time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	stats := o.stage(stageIndex)
+	stats.Errors++
+	o.observe(stats, duration)
+}
+
+func (o *StatsObserver) OnStageDone(stageIndex int, duration time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.stage(stageIndex).Duration = duration
+}
+
+// Stats returns the statistics of every observed stage, ordered by stage
+// index.
+func (o *StatsObserver) Stats() []StageStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	stats := make([]StageStats, 0, len(o.stages))
+	for _, stage := range o.stages {
+		stageStats := *stage
+		stageStats.P50 = percentile(stage.counts, .5)
+		stageStats.P90 = percentile(stage.counts, .9)
+		stageStats.P99 = percentile(stage.counts, .99)
+		stageStats.counts = nil
+		stats = append(stats, stageStats)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].StageIndex < stats[j].StageIndex })
+	return stats
+}
+
+// percentile returns the upper bound of the bucket holding the q quantile.
+func percentile(counts []int, q float64) time.Duration {
+	var total int
+	for _, count := range counts {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := int(q*float64(total-1)) + 1
+	for i, count := range counts {
+		if rank -= count; rank <= 0 {
+			if i == len(latencyBuckets) {
+				break
+			}
+			return latencyBuckets[i]
+		}
+	}
+	return latencyBuckets[len(latencyBuckets)-1]
+}
@@ -3,6 +3,7 @@ package updater
 import (
 	"context"
 	"strings"
+	"sync/atomic"
 
 	"github.com/nikunicke/reaktorw/pipeline"
 	"github.com/nikunicke/reaktorw/warehouse/inventory"
@@ -10,24 +11,48 @@ import (
 
 type availabilityUpdater struct {
 	updater Warehouse
+	// lot parks availabilities for unknown products while products are still
+	// being stored. Without a lot, or once the lot has been released, such
+	// availabilities are quarantined.
+	lot *parkingLot
+
+	quarantined int64
 }
 
-func newAvailabilityUpdater(updater Warehouse) *availabilityUpdater {
-	return &availabilityUpdater{updater: updater}
+func newAvailabilityUpdater(updater Warehouse, lot *parkingLot) *availabilityUpdater {
+	return &availabilityUpdater{updater: updater, lot: lot}
 }
 
 func (u *availabilityUpdater) Process(ctx context.Context, p pipeline.Payload) (pipeline.Payload, error) {
 	payload := p.(*availabilityPayload)
+	payload.mustBeLive()
 
 	availability := &inventory.Availability{
 		APIID:  strings.ToLower(payload.ID),
 		Status: payload.DecodedDataPayload,
 	}
-	if err := u.updater.UpsertAvailability(availability); err != nil {
-		if err == inventory.ErrAvailabilityForUnknownProduct {
+	err := u.updater.UpsertAvailability(availability)
+	if err == inventory.ErrAvailabilityForUnknownProduct && u.lot != nil {
+		if u.lot.park(availability) {
 			return nil, nil
 		}
+		// All products have been stored meanwhile, try once more.
+		err = u.updater.UpsertAvailability(availability)
+	}
+	if err == inventory.ErrAvailabilityForUnknownProduct {
+		if err := u.updater.QuarantineAvailability(availability); err != nil {
+			return nil, err
+		}
+		atomic.AddInt64(&u.quarantined, 1)
+		return nil, nil
+	}
+	if err != nil {
 		return nil, err
 	}
 	return p, nil
 }
+
+// Quarantined returns the number of availabilities quarantined so far.
+func (u *availabilityUpdater) Quarantined() int {
+	return int(atomic.LoadInt64(&u.quarantined))
+}
@@ -17,6 +17,7 @@ func newDataPayloadDecoder(updater Warehouse) *dataPayloadDecoder {
 
 func (u *dataPayloadDecoder) Process(ctx context.Context, p pipeline.Payload) (pipeline.Payload, error) {
 	availability := p.(*availabilityPayload)
+	availability.mustBeLive()
 
 	xmlData := struct {
 		InStockValue string `xml:"INSTOCKVALUE"`
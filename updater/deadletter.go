@@ -0,0 +1,43 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nikunicke/reaktorw/pipeline"
+)
+
+// FailedRecord describes an upstream record a pipeline failed to process.
+type FailedRecord struct {
+	Pipeline   string
+	StageIndex int
+	ID         string
+	Data       string
+	Err        error
+}
+
+type deadLetterSink struct {
+	pipelineName string
+	fn           func(FailedRecord)
+}
+
+func (s *deadLetterSink) Consume(_ context.Context, p pipeline.Payload) error {
+	deadLetter := p.(*pipeline.DeadLetter)
+	record := FailedRecord{
+		Pipeline:   s.pipelineName,
+		StageIndex: deadLetter.StageIndex,
+		Err:        deadLetter.Err,
+	}
+	switch payload := deadLetter.Payload.(type) {
+	case *productPayload:
+		payload.mustBeLive()
+		record.ID = payload.ID
+		record.Data = fmt.Sprintf("%s|%s|%v|%d|%s", payload.Category, payload.Name, payload.Colors, payload.Price, payload.Manufacturer)
+	case *availabilityPayload:
+		payload.mustBeLive()
+		record.ID = payload.ID
+		record.Data = payload.DataPayload
+	}
+	s.fn(record)
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build pipelinedebug
+// +build pipelinedebug
+
+package updater
+
+// debugPayloads poisons released payloads instead of recycling them, and
+// panics when they are used again. Enabled with the pipelinedebug build tag.
+const debugPayloads = true
@@ -0,0 +1,37 @@
+package updater
+
+import (
+	"sync"
+
+	"github.com/nikunicke/reaktorw/warehouse/inventory"
+)
+
+// parkingLot holds availabilities whose products have not been stored yet,
+// until all products of an update have been processed.
+type parkingLot struct {
+	mu       sync.Mutex
+	released bool
+	parked   []*inventory.Availability
+}
+
+// park holds availability until the lot is released. It reports false if the
+// lot has already been released.
+func (l *parkingLot) park(availability *inventory.Availability) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.released {
+		return false
+	}
+	l.parked = append(l.parked, availability)
+	return true
+}
+
+// release closes the lot and returns the parked availabilities.
+func (l *parkingLot) release() []*inventory.Availability {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.released = true
+	parked := l.parked
+	l.parked = nil
+	return parked
+}
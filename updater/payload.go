@@ -18,6 +18,9 @@ var (
 	}
 )
 
+// poisonedValue replaces the fields of payloads released in debug builds.
+const poisonedValue = "<released payload>"
+
 type productPayload struct {
 	ID           string
 	Category     string
@@ -25,36 +28,90 @@ type productPayload struct {
 	Colors       []string
 	Price        int32
 	Manufacturer string
+
+	released bool
 }
 
 func (p *productPayload) Clone() pipeline.Payload {
-	return nil
+	p.mustBeLive()
+	newP := productPayloadPool.Get().(*productPayload)
+	newP.released = false
+	newP.ID = p.ID
+	newP.Category = p.Category
+	newP.Name = p.Name
+	newP.Colors = append([]string(nil), p.Colors...)
+	newP.Price = p.Price
+	newP.Manufacturer = p.Manufacturer
+	return newP
 }
 
+func (p *productPayload) String() string { return "product " + p.ID }
+
+// MarkAsProcessed recycles the payload. Colors may be shared with the
+// badapi product the payload was created from, so it is dropped rather than
+// reused.
 func (p *productPayload) MarkAsProcessed() {
+	p.mustBeLive()
+	if debugPayloads {
+		p.ID, p.Category, p.Name, p.Manufacturer = poisonedValue, poisonedValue, poisonedValue, poisonedValue
+		p.Colors = []string{poisonedValue}
+		p.Price = -1
+		p.released = true
+		return
+	}
 	p.ID = p.ID[:0]
 	p.Category = p.Category[:0]
 	p.Name = p.Name[:0]
-	p.Colors = p.Colors[:0]
+	p.Colors = nil
 	p.Price = 0
 	p.Manufacturer = p.Manufacturer[:0]
 	productPayloadPool.Put(p)
 }
 
+// mustBeLive panics in debug builds if the payload has been released.
+func (p *productPayload) mustBeLive() {
+	if debugPayloads && p.released {
+		panic("updater: use of released product payload")
+	}
+}
+
 type availabilityPayload struct {
 	ID          string
 	DataPayload string
 
 	DecodedDataPayload string
+
+	released bool
 }
 
 func (p *availabilityPayload) Clone() pipeline.Payload {
-	return nil
+	p.mustBeLive()
+	newP := availabilityPayloadPool.Get().(*availabilityPayload)
+	newP.released = false
+	newP.ID = p.ID
+	newP.DataPayload = p.DataPayload
+	newP.DecodedDataPayload = p.DecodedDataPayload
+	return newP
 }
 
+func (p *availabilityPayload) String() string { return "availability " + p.ID }
+
 func (p *availabilityPayload) MarkAsProcessed() {
+	p.mustBeLive()
+	if debugPayloads {
+		p.ID, p.DataPayload, p.DecodedDataPayload = poisonedValue, poisonedValue, poisonedValue
+		p.released = true
+		return
+	}
 	p.ID = p.ID[:0]
 	p.DataPayload = p.DataPayload[:0]
 	p.DecodedDataPayload = p.DecodedDataPayload[:0]
 	availabilityPayloadPool.Put(p)
 }
+
+// mustBeLive panics in debug builds if the payload has been released.
+func (p *availabilityPayload) mustBeLive() {
+	if debugPayloads && p.released {
+		panic("updater: use of released availability payload")
+	}
+}
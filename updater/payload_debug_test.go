@@ -0,0 +1,58 @@
+//go:build pipelinedebug
+// +build pipelinedebug
+
+package updater
+
+import (
+	"context"
+
+	"github.com/juju/clock"
+	"github.com/nikunicke/reaktorw/badapi"
+	"github.com/nikunicke/reaktorw/warehouse/store/memory"
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(new(PayloadDebugTestSuite))
+
+type PayloadDebugTestSuite struct{}
+
+func (s *PayloadDebugTestSuite) TestReleasedProductPayloadIsPoisoned(c *check.C) {
+	p := newProductPayload(&badapi.Product{ID: "p1", Type: "gloves", Color: []string{"red"}})
+	p.MarkAsProcessed()
+
+	c.Assert(p.ID, check.Equals, poisonedValue)
+	c.Assert(p.Colors, check.DeepEquals, []string{poisonedValue})
+	c.Assert(func() { p.Clone() }, check.PanicMatches, ".*released product payload")
+	c.Assert(func() { p.MarkAsProcessed() }, check.PanicMatches, ".*released product payload")
+	proc := newProductUpdater(memory.NewInMemoryWarehouse(), clock.WallClock)
+	c.Assert(func() { _, _ = proc.Process(context.TODO(), p) }, check.PanicMatches, ".*released product payload")
+}
+
+func (s *PayloadDebugTestSuite) TestReleasedAvailabilityPayloadIsPoisoned(c *check.C) {
+	p := newAvailabilityPayload(&badapi.Response{ID: "P1", DataPayload: "<AVAILABILITY/>"})
+	p.MarkAsProcessed()
+
+	c.Assert(p.DataPayload, check.Equals, poisonedValue)
+	c.Assert(func() { p.Clone() }, check.PanicMatches, ".*released availability payload")
+	decoder := newDataPayloadDecoder(memory.NewInMemoryWarehouse())
+	c.Assert(func() { _, _ = decoder.Process(context.TODO(), p) }, check.PanicMatches, ".*released availability payload")
+}
+
+func (s *PayloadDebugTestSuite) TestSyncDoesNotUseReleasedPayloads(c *check.C) {
+	u := NewUpdater(Config{Warehouse: memory.NewInMemoryWarehouse(), Workers: 4, QueueSize: 8})
+	products := new(productIteratorStub)
+	var ids []string
+	for i := 0; i < 100; i++ {
+		id := string(rune('a'+i%26)) + string(rune('a'+i/26))
+		products.products = append(products.products, &badapi.Product{ID: id, Type: "gloves"})
+		ids = append(ids, id)
+	}
+
+	result, err := u.Sync(context.TODO(),
+		[]badapi.ProductIterator{products},
+		[]badapi.AvailabilityIterator{availabilities(ids...), availabilities("unknown")},
+	)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Products, check.Equals, 100)
+	c.Assert(result.Availabilities+result.Quarantined, check.Equals, 101)
+}
@@ -3,31 +3,33 @@ package updater
 import (
 	"context"
 	"strings"
-	"time"
 
+	"github.com/juju/clock"
 	"github.com/nikunicke/reaktorw/pipeline"
 	"github.com/nikunicke/reaktorw/warehouse/inventory"
 )
 
 type productUpdater struct {
 	updater Warehouse
+	clock   clock.Clock
 }
 
-func newProductUpdater(updater Warehouse) *productUpdater {
-	return &productUpdater{updater: updater}
+func newProductUpdater(updater Warehouse, clk clock.Clock) *productUpdater {
+	return &productUpdater{updater: updater, clock: clk}
 }
 
 func (u *productUpdater) Process(ctx context.Context, p pipeline.Payload) (pipeline.Payload, error) {
 	payload := p.(*productPayload)
+	payload.mustBeLive()
 
 	product := &inventory.Product{
 		APIID:        strings.ToLower(payload.ID),
 		Name:         payload.Name,
 		Category:     payload.Category,
 		Price:        payload.Price,
-		Colors:       payload.Colors,
+		Colors:       append([]string(nil), payload.Colors...),
 		Manufacturer: payload.Manufacturer,
-		RetrievedAt:  time.Now(),
+		RetrievedAt:  u.clock.Now(),
 	}
 	if err := u.updater.UpsertProduct(product); err != nil {
 		return nil, err
@@ -0,0 +1,7 @@
+//go:build !pipelinedebug
+// +build !pipelinedebug
+
+package updater
+
+// debugPayloads is disabled unless built with the pipelinedebug tag.
+const debugPayloads = false
@@ -2,7 +2,10 @@ package updater
 
 import (
 	"context"
+	"time"
 
+	"github.com/hashicorp/go-multierror"
+	"github.com/juju/clock"
 	"github.com/nikunicke/reaktorw/badapi"
 	"github.com/nikunicke/reaktorw/pipeline"
 	"github.com/nikunicke/reaktorw/warehouse/inventory"
@@ -12,60 +15,213 @@ import (
 type Warehouse interface {
 	UpsertProduct(product *inventory.Product) error
 	UpsertAvailability(availability *inventory.Availability) error
+	QuarantineAvailability(availability *inventory.Availability) error
 }
 
 // Config for the updater
 type Config struct {
 	Warehouse Warehouse
 	Workers   int
+	// Clock stamps the products when they are retrieved. It defaults to the
+	// wall clock and should be the clock the warehouse stamps availabilities
+	// with.
+	Clock clock.Clock
+
+	// Observe optionally returns an observer for each pipeline run, e.g. to
+	// collect metrics or log the stages' work.
+	Observe func(pipelineName string) pipeline.Observer
+	// DeadLetter is optionally called with every record a pipeline failed to
+	// process. Malformed availability data payloads are skipped, other
+	// failures abort the update.
+	DeadLetter func(FailedRecord)
+
+	// QueueSize is the number of payloads buffered in front of each stage.
+	QueueSize int
+	// ObserveQueue is optionally called with the depth of a stage's queue
+	// whenever a payload is queued for it.
+	ObserveQueue func(pipelineName string, stageIndex, depth int)
+	// DrainTimeout enables drain mode: once the update is cancelled, the
+	// payloads already read keep being stored for up to DrainTimeout.
+	DrainTimeout time.Duration
 }
 
+// Pipeline names passed to Config.Observe and used as SyncResult.Stages keys.
+const (
+	ProductsPipeline       = "products"
+	AvailabilitiesPipeline = "availabilities"
+)
+
 // Updater represents updater pipeline
 type Updater struct {
-	pp *pipeline.Pipeline
-	ap *pipeline.Pipeline
+	conf Config
+}
+
+// SyncResult holds the number of products and availabilities processed by
+// an update, and the number of availabilities quarantined because their
+// products are unknown. InFlight counts the records left unprocessed when
+// the update was cancelled or failed. Stages holds the statistics of each pipeline's
+// stages, keyed by pipeline name.
+type SyncResult struct {
+	Products       int
+	Availabilities int
+	Quarantined    int
+	InFlight       int
+	Stages         map[string][]pipeline.StageStats
 }
 
 // NewUpdater initiates a new warehouse updater pipeline
 func NewUpdater(conf Config) *Updater {
-	return &Updater{
-		pp: assembleProductsUpdaterPipeline(conf),
-		ap: assembleAvailabilitiesUpdaterPipeline(conf),
+	if conf.Clock == nil {
+		conf.Clock = clock.WallClock
 	}
+	return &Updater{conf: conf}
 }
 
-func assembleProductsUpdaterPipeline(conf Config) *pipeline.Pipeline {
-	return pipeline.New(
-		pipeline.FixedWorkerPool(
-			newProductUpdater(conf.Warehouse), uint(conf.Workers),
-		),
-	)
+// configure applies the dead-letter, queue and observer settings to p. Stage
+// statistics are collected by stats.
+func (c Config) configure(p *pipeline.Pipeline, pipelineName string, stats *pipeline.StatsObserver) *pipeline.Pipeline {
+	if c.Observe != nil {
+		p.WithObserver(pipeline.MultiObserver(stats, c.Observe(pipelineName)))
+	} else {
+		p.WithObserver(stats)
+	}
+	if c.DrainTimeout > 0 {
+		p.WithDrain(c.DrainTimeout)
+	}
+	if c.DeadLetter != nil {
+		p.WithDeadLetter(&deadLetterSink{pipelineName: pipelineName, fn: c.DeadLetter})
+	}
+	if c.ObserveQueue != nil {
+		p.ObserveQueues(func(stageIndex, depth int, _ bool) {
+			c.ObserveQueue(pipelineName, stageIndex, depth)
+		})
+	}
+	return p.WithQueues(pipeline.QueueConfig{Size: c.QueueSize})
+}
+
+func assembleProductsUpdaterPipeline(conf Config, stats *pipeline.StatsObserver) *pipeline.Pipeline {
+	return conf.configure(pipeline.New(
+		pipeline.FixedWorkerPool(newProductUpdater(conf.Warehouse, conf.Clock), uint(conf.Workers)),
+	), ProductsPipeline, stats)
 }
 
-func assembleAvailabilitiesUpdaterPipeline(conf Config) *pipeline.Pipeline {
-	return pipeline.New(
+func assembleAvailabilitiesUpdaterPipeline(conf Config, availUpdater *availabilityUpdater, stats *pipeline.StatsObserver) *pipeline.Pipeline {
+	return conf.configure(pipeline.New(
 		pipeline.FixedWorkerPool(
 			newDataPayloadDecoder(conf.Warehouse), uint(conf.Workers),
+			pipeline.WithErrorPolicy(pipeline.SkipOnError()),
 		),
-		pipeline.FixedWorkerPool(
-			newAvailabilityUpdater(conf.Warehouse), uint(conf.Workers),
-		),
-	)
+		pipeline.FixedWorkerPool(availUpdater, uint(conf.Workers)),
+	), AvailabilitiesPipeline, stats)
 }
 
 // Update feeds the warehouse with product- and availability data. Should maybe purge old data as well ...
-func (u *Updater) Update(ctx context.Context, productIt badapi.ProductIterator, availabilityIt badapi.AvailabilityIterator) (int, int, error) {
-	productSink := new(countingSink)
-	availabilitySink := new(countingSink)
-	if err := u.pp.Process(ctx, &productsSource{productIt: productIt}, productSink); err != nil {
-		return productSink.GetCount(), availabilitySink.GetCount(), err
+func (u *Updater) Update(ctx context.Context, productIt badapi.ProductIterator, availabilityIt badapi.AvailabilityIterator) (SyncResult, error) {
+	return u.Sync(ctx, []badapi.ProductIterator{productIt}, []badapi.AvailabilityIterator{availabilityIt})
+}
+
+// UpdateProducts feeds the warehouse with product data and returns the number
+// of products processed.
+func (u *Updater) UpdateProducts(ctx context.Context, productIt badapi.ProductIterator) (int, error) {
+	sink := new(countingSink)
+	pp := assembleProductsUpdaterPipeline(u.conf, pipeline.NewStatsObserver())
+	_, err := pp.Process(ctx, sink, &productsSource{productIt: productIt})
+	return sink.GetCount(), err
+}
+
+// UpdateAvailabilities feeds the warehouse with availability data for the
+// products already stored. Availabilities of unknown products are
+// quarantined.
+func (u *Updater) UpdateAvailabilities(ctx context.Context, availabilityIt badapi.AvailabilityIterator) (SyncResult, error) {
+	return u.Sync(ctx, nil, []badapi.AvailabilityIterator{availabilityIt})
+}
+
+// Sync feeds the warehouse with products and availabilities concurrently.
+// Each iterator is a source of its own, read as soon as it has data, so
+// iterators may block until their data has been loaded. Availabilities for
+// products that have not been stored yet are parked and retried once all
+// products have been processed, and quarantined if their products are still
+// unknown.
+func (u *Updater) Sync(ctx context.Context, productIts []badapi.ProductIterator, availabilityIts []badapi.AvailabilityIterator) (SyncResult, error) {
+	syncCtx, cancelFn := context.WithCancel(ctx)
+	defer cancelFn()
+
+	lot := new(parkingLot)
+	availUpdater := newAvailabilityUpdater(u.conf.Warehouse, lot)
+	productStats, availabilityStats := pipeline.NewStatsObserver(), pipeline.NewStatsObserver()
+	var (
+		products, retried, quarantined int
+		unparked                       int
+		productsResult                 pipeline.Result
+		productsErr                    error
+		productsDone                   = make(chan struct{})
+	)
+	go func() {
+		defer close(productsDone)
+		sink := new(countingSink)
+		pp := assembleProductsUpdaterPipeline(u.conf, productStats)
+		productsResult, productsErr = pp.Process(syncCtx, sink, productSources(productIts)...)
+		products = sink.GetCount()
+		if productsErr != nil {
+			cancelFn()
+		}
+		// Parked availabilities are stored or quarantined even if the
+		// products failed, so that none is lost silently.
+		parked := lot.release()
+		for i, availability := range parked {
+			err := u.conf.Warehouse.UpsertAvailability(availability)
+			if err == inventory.ErrAvailabilityForUnknownProduct {
+				if err = u.conf.Warehouse.QuarantineAvailability(availability); err == nil {
+					quarantined++
+					continue
+				}
+			}
+			if err != nil {
+				productsErr = multierror.Append(productsErr, err)
+				unparked = len(parked) - i
+				cancelFn()
+				return
+			}
+			retried++
+		}
+	}()
+
+	sink := new(countingSink)
+	ap := assembleAvailabilitiesUpdaterPipeline(u.conf, availUpdater, availabilityStats)
+	availabilitiesResult, err := ap.Process(syncCtx, sink, availabilitySources(availabilityIts)...)
+	if err != nil {
+		cancelFn()
+	}
+	<-productsDone
+	if productsErr != nil {
+		err = multierror.Append(err, productsErr)
 	}
-	if err := u.ap.Process(ctx, &availabilitiesSource{availabilityIt: availabilityIt}, availabilitySink); err != nil {
-		return productSink.GetCount(), availabilitySink.GetCount(), err
+	return SyncResult{
+		Products:       products,
+		Availabilities: sink.GetCount() + retried,
+		Quarantined:    availUpdater.Quarantined() + quarantined,
+		InFlight:       productsResult.InFlight + availabilitiesResult.InFlight + unparked,
+		Stages: map[string][]pipeline.StageStats{
+			ProductsPipeline:       productStats.Stats(),
+			AvailabilitiesPipeline: availabilityStats.Stats(),
+		},
+	}, err
+}
+
+func productSources(its []badapi.ProductIterator) []pipeline.Source {
+	sources := make([]pipeline.Source, len(its))
+	for i, it := range its {
+		sources[i] = &productsSource{productIt: it}
+	}
+	return sources
+}
+
+func availabilitySources(its []badapi.AvailabilityIterator) []pipeline.Source {
+	sources := make([]pipeline.Source, len(its))
+	for i, it := range its {
+		sources[i] = &availabilitiesSource{availabilityIt: it}
 	}
-	return productSink.GetCount(),
-		availabilitySink.GetCount(),
-		nil
+	return sources
 }
 
 type productsSource struct {
@@ -79,7 +235,16 @@ type availabilitiesSource struct {
 func (ps *productsSource) Error() error              { return ps.productIt.Error() }
 func (ps *productsSource) Next(context.Context) bool { return ps.productIt.Next() }
 func (ps *productsSource) Payload() pipeline.Payload {
-	product := ps.productIt.Product()
+	return newProductPayload(ps.productIt.Product())
+}
+
+func (as *availabilitiesSource) Error() error              { return as.availabilityIt.Error() }
+func (as *availabilitiesSource) Next(context.Context) bool { return as.availabilityIt.Next() }
+func (as *availabilitiesSource) Payload() pipeline.Payload {
+	return newAvailabilityPayload(as.availabilityIt.Availability())
+}
+
+func newProductPayload(product *badapi.Product) *productPayload {
 	payload := productPayloadPool.Get().(*productPayload)
 	payload.ID = product.ID
 	payload.Name = product.Name
@@ -90,10 +255,7 @@ func (ps *productsSource) Payload() pipeline.Payload {
 	return payload
 }
 
-func (as *availabilitiesSource) Error() error              { return as.availabilityIt.Error() }
-func (as *availabilitiesSource) Next(context.Context) bool { return as.availabilityIt.Next() }
-func (as *availabilitiesSource) Payload() pipeline.Payload {
-	availability := as.availabilityIt.Availability()
+func newAvailabilityPayload(availability *badapi.Response) *availabilityPayload {
 	payload := availabilityPayloadPool.Get().(*availabilityPayload)
 	payload.ID = availability.ID
 	payload.DataPayload = availability.DataPayload
@@ -0,0 +1,97 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nikunicke/reaktorw/badapi"
+	"github.com/nikunicke/reaktorw/warehouse/inventory"
+	"github.com/nikunicke/reaktorw/warehouse/store/memory"
+	"golang.org/x/xerrors"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+var _ = check.Suite(new(UpdaterTestSuite))
+
+type UpdaterTestSuite struct{}
+
+// failingWarehouse fails to store the product with the given badapi ID.
+type failingWarehouse struct {
+	*memory.InMemoryWarehouse
+	failID string
+}
+
+func (w *failingWarehouse) UpsertProduct(product *inventory.Product) error {
+	if product.APIID == w.failID {
+		return xerrors.New("disk full")
+	}
+	return w.InMemoryWarehouse.UpsertProduct(product)
+}
+
+// productIteratorStub waits for delay before its first product.
+type productIteratorStub struct {
+	delay    time.Duration
+	products []*badapi.Product
+	curr     int
+}
+
+func (i *productIteratorStub) Next() bool {
+	if i.curr == 0 {
+		time.Sleep(i.delay)
+	}
+	i.curr++
+	return i.curr <= len(i.products)
+}
+func (i *productIteratorStub) Error() error             { return nil }
+func (i *productIteratorStub) Close() error             { return nil }
+func (i *productIteratorStub) Product() *badapi.Product { return i.products[i.curr-1] }
+
+type availabilityIteratorStub struct {
+	availabilities []*badapi.Response
+	curr           int
+}
+
+func (i *availabilityIteratorStub) Next() bool {
+	i.curr++
+	return i.curr <= len(i.availabilities)
+}
+func (i *availabilityIteratorStub) Error() error { return nil }
+func (i *availabilityIteratorStub) Close() error { return nil }
+func (i *availabilityIteratorStub) Availability() *badapi.Response {
+	return i.availabilities[i.curr-1]
+}
+
+func availabilities(ids ...string) *availabilityIteratorStub {
+	it := new(availabilityIteratorStub)
+	for _, id := range ids {
+		it.availabilities = append(it.availabilities, &badapi.Response{
+			ID:          id,
+			DataPayload: "<AVAILABILITY><INSTOCKVALUE>INSTOCK</INSTOCKVALUE></AVAILABILITY>",
+		})
+	}
+	return it
+}
+
+func (s *UpdaterTestSuite) TestParkedAvailabilitiesQuarantinedWhenProductsFail(c *check.C) {
+	warehouse := &failingWarehouse{InMemoryWarehouse: memory.NewInMemoryWarehouse(), failID: "p1"}
+	u := NewUpdater(Config{Warehouse: warehouse, Workers: 2})
+	// The products arrive after the availabilities have been parked.
+	products := &productIteratorStub{delay: 50 * time.Millisecond}
+	for i := 0; i < 3; i++ {
+		products.products = append(products.products, &badapi.Product{ID: fmt.Sprintf("p%d", i), Type: "gloves"})
+	}
+
+	result, err := u.Sync(context.TODO(),
+		[]badapi.ProductIterator{products},
+		[]badapi.AvailabilityIterator{availabilities("P0", "P1", "P2", "P3")},
+	)
+	c.Assert(err, check.ErrorMatches, "(?s).*disk full.*")
+	// Every availability was parked, so none is left in flight.
+	c.Assert(result.Availabilities+result.Quarantined, check.Equals, 4)
+	c.Assert(warehouse.QuarantineStats().Size, check.Equals, result.Quarantined)
+	c.Assert(result.Quarantined > 0, check.Equals, true)
+}
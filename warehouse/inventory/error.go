@@ -1,10 +1,19 @@
 package inventory
 
-import "golang.org/x/xerrors"
+// Error is a warehouse error. Code is a stable, machine-readable identifier
+// that can be exposed to API clients.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return "warehouse: " + e.Message
+}
 
 var (
-	ErrUnknownProductID              = xerrors.New("warehouse: unknown product ID")
-	ErrNoDataForCategory             = xerrors.New("warehouse: no data for category")
-	ErrAvailabilityForUnknownProduct = xerrors.New("warehouse: availability for unknown product")
-	ErrUnknownAvailabilityID         = xerrors.New("warehouse: unknown availability ID")
+	ErrUnknownProductID              = &Error{Code: "unknown_product_id", Message: "unknown product ID"}
+	ErrNoDataForCategory             = &Error{Code: "no_data_for_category", Message: "no data for category"}
+	ErrAvailabilityForUnknownProduct = &Error{Code: "availability_for_unknown_product", Message: "availability for unknown product"}
+	ErrUnknownAvailabilityID         = &Error{Code: "unknown_availability_id", Message: "unknown availability ID"}
 )
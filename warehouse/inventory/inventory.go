@@ -10,11 +10,25 @@ import (
 type Inventory interface {
 	UpsertProduct(product *Product) error
 	FindProduct(id uuid.UUID) (*Product, error)
+	FindProductByAPIID(apiID string) (*Product, error)
 	UpsertAvailability(availability *Availability) error
 	FindAvailability(id uuid.UUID) (*Availability, error)
+	FindAvailabilityByAPIID(apiID string) (*Availability, error)
 	Products(fromID, toID uuid.UUID, retrievedBefore time.Time) (ProductIterator, error)
 	Availabilities(fromID, toID uuid.UUID, updatedBefore time.Time) (AvailabilityIterator, error)
 	ProductsCategory(ctg string) (ProductIterator, error)
+	CategoryVersion(ctg string) uint64
+	QuarantineAvailability(availability *Availability) error
+	ExpireQuarantine(quarantinedBefore time.Time) (int, error)
+	QuarantineStats() QuarantineStats
+}
+
+// QuarantineStats describes the availabilities held in quarantine because
+// their products are unknown. Joined and Expired are running totals.
+type QuarantineStats struct {
+	Size    int    `json:"size"`
+	Joined  uint64 `json:"joined"`
+	Expired uint64 `json:"expired"`
 }
 
 type Product struct {
@@ -36,7 +50,7 @@ type Availability struct {
 	Status       string    `json:"status"`
 	Manufacturer string    `json:"manufacturer"`
 
-	UpdatedAt time.Time
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type ProductIterator interface {
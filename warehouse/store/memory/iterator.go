@@ -21,7 +21,7 @@ func (i *productIterator) Error() error { return nil }
 func (i *productIterator) Close() error { return nil }
 
 func (i *productIterator) Product() *inventory.Product {
-	i.s.mu.RLock()
+	i.s.rlock()
 	defer i.s.mu.RUnlock()
 
 	productCopy := new(inventory.Product)
@@ -35,12 +35,18 @@ type availabilityIterator struct {
 	currIndex      int
 }
 
-func (i *availabilityIterator) Next() bool   { return false }
+func (i *availabilityIterator) Next() bool {
+	if i.currIndex >= len(i.availabilities) {
+		return false
+	}
+	i.currIndex++
+	return true
+}
 func (i *availabilityIterator) Error() error { return nil }
 func (i *availabilityIterator) Close() error { return nil }
 
 func (i *availabilityIterator) Availability() *inventory.Availability {
-	i.s.mu.RLock()
+	i.s.rlock()
 	defer i.s.mu.RUnlock()
 
 	availabilityCopy := new(inventory.Availability)
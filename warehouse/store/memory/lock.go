@@ -0,0 +1,33 @@
+package memory
+
+import "time"
+
+// LockObserver is notified of the time spent waiting to acquire the warehouse
+// lock. write is set for read-write locks.
+type LockObserver func(write bool, wait time.Duration)
+
+// ObserveLockWait sets a LockObserver for the warehouse. It must be called
+// before the warehouse is used concurrently.
+func (s *InMemoryWarehouse) ObserveLockWait(o LockObserver) {
+	s.lockObserver = o
+}
+
+func (s *InMemoryWarehouse) lock() {
+	if s.lockObserver == nil {
+		s.mu.Lock()
+		return
+	}
+	startAt := time.Now()
+	s.mu.Lock()
+	s.lockObserver(true, time.Since(startAt))
+}
+
+func (s *InMemoryWarehouse) rlock() {
+	if s.lockObserver == nil {
+		s.mu.RLock()
+		return
+	}
+	startAt := time.Now()
+	s.mu.RLock()
+	s.lockObserver(false, time.Since(startAt))
+}
@@ -6,19 +6,26 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/juju/clock"
 	"github.com/nikunicke/reaktorw/warehouse/inventory"
 )
 
 // InMemoryWarehouse represents the infrastructure of a warehouse
 type InMemoryWarehouse struct {
-	mu sync.RWMutex
+	mu           sync.RWMutex
+	lockObserver LockObserver
+	clock        clock.Clock
 
 	products                 map[uuid.UUID]*inventory.Product
 	availabilities           map[uuid.UUID]*inventory.Availability
 	productsCategory         map[string]productList
+	categoryVersion          map[string]uint64
 	availabilityManufacturer map[string]availabilityList
 	productAPIIndex          map[string]*inventory.Product
 	availabilityAPIIndex     map[string]*inventory.Availability
+
+	quarantine      map[string]*inventory.Availability
+	quarantineStats inventory.QuarantineStats
 }
 
 type productList []*inventory.Product
@@ -28,19 +35,32 @@ type availabilityList []*inventory.Availability
 // warehouse.
 func NewInMemoryWarehouse() *InMemoryWarehouse {
 	return &InMemoryWarehouse{
+		clock:                    clock.WallClock,
 		products:                 make(map[uuid.UUID]*inventory.Product),
 		availabilities:           make(map[uuid.UUID]*inventory.Availability),
 		productsCategory:         make(map[string]productList),
+		categoryVersion:          make(map[string]uint64),
 		availabilityManufacturer: make(map[string]availabilityList),
 		productAPIIndex:          make(map[string]*inventory.Product),
 		availabilityAPIIndex:     make(map[string]*inventory.Availability),
+		quarantine:               make(map[string]*inventory.Availability),
 	}
 }
 
-// UpsertProduct inserts or updates a product.
+// UseClock sets the clock availabilities are stamped with, which must be the
+// clock ExpireQuarantine cutoffs are taken from. It must be called before the
+// warehouse is used concurrently.
+func (s *InMemoryWarehouse) UseClock(clk clock.Clock) {
+	s.clock = clk
+}
+
+// UpsertProduct inserts or updates a product. New products keep their ID if
+// it is set and not taken, e.g. when replicating another warehouse. A
+// quarantined availability for the product is joined with it.
 func (s *InMemoryWarehouse) UpsertProduct(product *inventory.Product) error {
-	s.mu.Lock()
+	s.lock()
 	defer s.mu.Unlock()
+	defer s.joinQuarantined(product.APIID)
 
 	if existing := s.productAPIIndex[product.APIID]; existing != nil {
 		product.ID = existing.ID
@@ -49,13 +69,11 @@ func (s *InMemoryWarehouse) UpsertProduct(product *inventory.Product) error {
 		if origTs.After(existing.RetrievedAt) {
 			existing.RetrievedAt = origTs
 		}
+		s.bumpCategoryVersion(existing.Category)
 		return nil
 	}
-	for {
+	for product.ID == uuid.Nil || s.products[product.ID] != nil {
 		product.ID = uuid.New()
-		if s.products[product.ID] == nil {
-			break
-		}
 	}
 	productCopy := new(inventory.Product)
 	*productCopy = *product
@@ -65,13 +83,14 @@ func (s *InMemoryWarehouse) UpsertProduct(product *inventory.Product) error {
 		s.productsCategory[strings.ToLower(productCopy.Category)] =
 			append(s.productsCategory[strings.ToLower(productCopy.Category)], productCopy)
 	}
+	s.bumpCategoryVersion(productCopy.Category)
 	return nil
 }
 
 // FindProduct returns a Product or an error if there is not any matching IDs.
 // Exactly one return value will be non-nil.
 func (s *InMemoryWarehouse) FindProduct(id uuid.UUID) (*inventory.Product, error) {
-	s.mu.RLock()
+	s.rlock()
 	defer s.mu.RUnlock()
 
 	product := s.products[id]
@@ -83,13 +102,28 @@ func (s *InMemoryWarehouse) FindProduct(id uuid.UUID) (*inventory.Product, error
 	return productCopy, nil
 }
 
+// FindProductByAPIID returns the Product matching the upstream API ID or an
+// error. Exactly one return value will be non-nil.
+func (s *InMemoryWarehouse) FindProductByAPIID(apiID string) (*inventory.Product, error) {
+	s.rlock()
+	defer s.mu.RUnlock()
+
+	product := s.productAPIIndex[apiID]
+	if product == nil {
+		return nil, inventory.ErrUnknownProductID
+	}
+	productCopy := new(inventory.Product)
+	*productCopy = *product
+	return productCopy, nil
+}
+
 // Products returns an iterator or an error. Exactly one return value will be
 // non-nil.
 func (s *InMemoryWarehouse) Products(fromID, toID uuid.UUID, retrievedBefore time.Time) (inventory.ProductIterator, error) {
 	from, to := fromID.String(), toID.String()
 	var list productList
 
-	s.mu.RLock()
+	s.rlock()
 	defer s.mu.RUnlock()
 
 	for productID, product := range s.products {
@@ -104,7 +138,7 @@ func (s *InMemoryWarehouse) Products(fromID, toID uuid.UUID, retrievedBefore tim
 // category. Exactly one of inventory.ProductIterator or error will be non-nil.
 // Error is returned if the specified category does not include any products
 func (s *InMemoryWarehouse) ProductsCategory(ctg string) (inventory.ProductIterator, error) {
-	s.mu.RLock()
+	s.rlock()
 	defer s.mu.RUnlock()
 	products, ctgExists := s.productsCategory[strings.ToLower(ctg)]
 	if !ctgExists {
@@ -113,32 +147,65 @@ func (s *InMemoryWarehouse) ProductsCategory(ctg string) (inventory.ProductItera
 	return &productIterator{s: s, products: products}, nil
 }
 
-// UpsertAvailability inserts or updates an existing availability.
+// CategoryVersion returns a counter that is incremented every time a product
+// belonging to the category, or its availability, is written. Zero is returned
+// for categories without any data.
+func (s *InMemoryWarehouse) CategoryVersion(ctg string) uint64 {
+	s.rlock()
+	defer s.mu.RUnlock()
+
+	return s.categoryVersion[strings.ToLower(ctg)]
+}
+
+// CategorySizes returns the number of products stored per category.
+func (s *InMemoryWarehouse) CategorySizes() map[string]int {
+	s.rlock()
+	defer s.mu.RUnlock()
+
+	sizes := make(map[string]int, len(s.productsCategory))
+	for ctg, products := range s.productsCategory {
+		sizes[ctg] = len(products)
+	}
+	return sizes
+}
+
+// bumpCategoryVersion must be called with the write lock held.
+func (s *InMemoryWarehouse) bumpCategoryVersion(ctg string) {
+	if ctg != "" {
+		s.categoryVersion[strings.ToLower(ctg)]++
+	}
+}
+
+// UpsertAvailability inserts or updates an existing availability. New
+// availabilities keep their ID if it is set and not taken.
 func (s *InMemoryWarehouse) UpsertAvailability(availability *inventory.Availability) error {
-	s.mu.Lock()
+	s.lock()
 	defer s.mu.Unlock()
 
+	return s.upsertAvailability(availability)
+}
+
+// upsertAvailability must be called with the write lock held.
+func (s *InMemoryWarehouse) upsertAvailability(availability *inventory.Availability) error {
 	product := s.productAPIIndex[availability.APIID]
 	if product == nil {
 		return inventory.ErrAvailabilityForUnknownProduct
 	}
 	product.Availability = availability.Status
+	s.bumpCategoryVersion(product.Category)
 	availability.ProductID = product.ID
 	availability.Manufacturer = product.Manufacturer
 	if existing := s.availabilityAPIIndex[availability.APIID]; existing != nil {
 		availability.ID = existing.ID
 		availability.ProductID = existing.ProductID
 		*existing = *availability
-		existing.UpdatedAt = time.Now()
+		existing.UpdatedAt = s.clock.Now()
 		return nil
 	}
-	for {
+	for availability.ID == uuid.Nil || s.availabilities[availability.ID] != nil {
 		availability.ID = uuid.New()
-		if s.availabilities[availability.ID] == nil {
-			break
-		}
 	}
-	availability.UpdatedAt = time.Now()
+	availability.UpdatedAt = s.clock.Now()
 	availabilityCopy := new(inventory.Availability)
 	*availabilityCopy = *availability
 	s.availabilities[availabilityCopy.ID] = availabilityCopy
@@ -149,7 +216,7 @@ func (s *InMemoryWarehouse) UpsertAvailability(availability *inventory.Availabil
 // FindAvailability returns an *inventory.Availability or an error. Exactly one
 // return value will be non-nil.
 func (s *InMemoryWarehouse) FindAvailability(id uuid.UUID) (*inventory.Availability, error) {
-	s.mu.RLock()
+	s.rlock()
 	defer s.mu.RUnlock()
 
 	availability := s.availabilities[id]
@@ -161,13 +228,28 @@ func (s *InMemoryWarehouse) FindAvailability(id uuid.UUID) (*inventory.Availabil
 	return availabilityCopy, nil
 }
 
+// FindAvailabilityByAPIID returns the *inventory.Availability matching the
+// upstream API ID or an error. Exactly one return value will be non-nil.
+func (s *InMemoryWarehouse) FindAvailabilityByAPIID(apiID string) (*inventory.Availability, error) {
+	s.rlock()
+	defer s.mu.RUnlock()
+
+	availability := s.availabilityAPIIndex[apiID]
+	if availability == nil {
+		return nil, inventory.ErrUnknownAvailabilityID
+	}
+	availabilityCopy := new(inventory.Availability)
+	*availabilityCopy = *availability
+	return availabilityCopy, nil
+}
+
 // Availabilities returns an iterator or an error. Exactly one return value will
 // be non-nil.
 func (s *InMemoryWarehouse) Availabilities(fromID, toID uuid.UUID, updatedBefore time.Time) (inventory.AvailabilityIterator, error) {
 	from, to := fromID.String(), toID.String()
 	var list []*inventory.Availability
 
-	s.mu.RLock()
+	s.rlock()
 	defer s.mu.RUnlock()
 
 	for availabilityID, availability := range s.availabilities {
@@ -177,3 +259,60 @@ func (s *InMemoryWarehouse) Availabilities(fromID, toID uuid.UUID, updatedBefore
 	}
 	return &availabilityIterator{s: s, availabilities: list}, nil
 }
+
+// QuarantineAvailability holds an availability whose product is unknown until
+// the product is upserted or the availability expires. A newer availability
+// for the same product replaces the quarantined one.
+func (s *InMemoryWarehouse) QuarantineAvailability(availability *inventory.Availability) error {
+	s.lock()
+	defer s.mu.Unlock()
+
+	if s.productAPIIndex[availability.APIID] != nil {
+		return s.upsertAvailability(availability)
+	}
+	availabilityCopy := new(inventory.Availability)
+	*availabilityCopy = *availability
+	availabilityCopy.UpdatedAt = s.clock.Now()
+	s.quarantine[availabilityCopy.APIID] = availabilityCopy
+	return nil
+}
+
+// ExpireQuarantine drops the availabilities quarantined before
+// quarantinedBefore and returns their count.
+func (s *InMemoryWarehouse) ExpireQuarantine(quarantinedBefore time.Time) (int, error) {
+	s.lock()
+	defer s.mu.Unlock()
+
+	var expired int
+	for apiID, availability := range s.quarantine {
+		if availability.UpdatedAt.Before(quarantinedBefore) {
+			delete(s.quarantine, apiID)
+			expired++
+		}
+	}
+	s.quarantineStats.Expired += uint64(expired)
+	return expired, nil
+}
+
+// QuarantineStats returns the number of quarantined availabilities and the
+// running totals of joined and expired ones.
+func (s *InMemoryWarehouse) QuarantineStats() inventory.QuarantineStats {
+	s.rlock()
+	defer s.mu.RUnlock()
+
+	stats := s.quarantineStats
+	stats.Size = len(s.quarantine)
+	return stats
+}
+
+// joinQuarantined must be called with the write lock held.
+func (s *InMemoryWarehouse) joinQuarantined(apiID string) {
+	availability := s.quarantine[apiID]
+	if availability == nil || s.productAPIIndex[apiID] == nil {
+		return
+	}
+	delete(s.quarantine, apiID)
+	if err := s.upsertAvailability(availability); err == nil {
+		s.quarantineStats.Joined++
+	}
+}